@@ -0,0 +1,9 @@
+package data
+
+// AssetRequestは、名前で管理するスプライト画像の読み込みや解放の指定です。
+// 同じファイルから読み込んだ画像は一つのテクスチャを共有します。
+type AssetRequest struct {
+	Name     string // スプライト画像の名前（IDはRenderer.ImageIDで取得する）
+	Filename string // 読み込む画像ファイル（AssetLoadの場合のみ）
+	Rect     Rect   // ファイル上の矩形（幅か高さが0ならファイル全体。AssetLoadの場合のみ）
+}
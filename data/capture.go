@@ -0,0 +1,19 @@
+package data
+
+// Captureは、画面を画像ファイルに保存する設定です。
+type Capture struct {
+	Filename string        // 保存先のファイル名（連番のPNGでは"frame%04d.png"のように番号の書式を含められる）
+	Format   CaptureFormat // 保存する形式
+	Duration uint32        // 記録する時間（ミリ秒。CapturePNGの場合は使用しない。CaptureGIFは750枚までで打ち切る）
+	Interval uint32        // 記録する間隔（ミリ秒。0なら40ミリ秒）
+}
+
+// 保存する形式の列挙型
+type CaptureFormat int8
+
+// CaptureFormat型の値
+const (
+	CapturePNG         CaptureFormat = iota // 現在の画面を一枚のPNGに保存する
+	CapturePNGSequence                      // 一定時間の画面を連番のPNGに保存する
+	CaptureGIF                              // 一定時間の画面をアニメーションGIFに保存する
+)
@@ -0,0 +1,29 @@
+package data
+
+// Colliderは、スプライトの当たり判定の設定です。
+// 当たり判定はスプライトの拡大・回転・裏返しを反映した位置で行い、非表示のスプライトも対象になります。
+type Collider struct {
+	Shape  ColliderShape // 当たり判定の形（ColliderNoneなら判定しない）
+	Layer  uint32        // 所属する衝突レイヤー（ビットごとに一つのレイヤー）
+	Mask   uint32        // 衝突する相手の衝突レイヤー（互いのMaskが相手のLayerを含む場合のみ判定する）
+	Radius int32         // 円の半径（ColliderCircleの場合のみ。0ならDistRectに内接する円）
+	Stay   bool          // trueなら接触し続けている間、更新ごとにCollisionStayを送る（どちらかが指定していれば送る）
+}
+
+// 当たり判定の形の列挙型
+type ColliderShape int8
+
+// ColliderShape型の値
+const (
+	ColliderNone     ColliderShape = iota // 判定しない
+	ColliderBox                           // 回転を無視したDistRectの矩形
+	ColliderCircle                        // DistRectの中心を中心とする円
+	ColliderOriented                      // 回転を反映したDistRectの矩形
+	ColliderPixel                         // スプライト画像の不透明な部分
+)
+
+// Collisionは、二つのスプライトの接触の情報です。
+type Collision struct {
+	A SpriteIdentifier // 接触したスプライト
+	B SpriteIdentifier // 接触した相手のスプライト
+}
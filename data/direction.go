@@ -0,0 +1,178 @@
+package data
+
+import "image"
+
+// Directionは、App側からRendererへ送る描画の指示です。
+// スプライトの追加・更新に加えて、削除や表示の切り替え、レイヤーの操作を同じチャンネルで送信します。
+type Direction struct {
+	Code       DirectionCode      // 指示の種類
+	Sprite     *Sprite            // 追加・更新するスプライト（SpritePutの場合のみ。Rendererが保持するため、送信後に変更してはいけない）
+	SpriteID   SpriteIdentifier   // 対象のスプライト
+	LayerID    LayerIdentifier    // 対象のレイヤー（SpriteMoveの場合は移動先）
+	Count      int                // 放出する粒子の数（EmitterBurstの場合のみ）
+	Layer      LayerProperty      // レイヤーの設定（LayerAdd, LayerSetPropertyの場合のみ）
+	Transition Transition         // 画面効果（TransitionStartの場合のみ）
+	Capture    Capture            // 画面の保存の設定（CaptureStartの場合のみ）
+	Image      GeneratedImage     // 登録する画像（ImagePut, ImageRemoveの場合のみ）
+	Compose    ImageComposition   // 画像を作成する設定（ImageComposeの場合のみ）
+	Asset      AssetRequest       // 名前で管理する画像の指定（AssetLoad, AssetRelease, AssetUnloadの場合のみ）
+	ViewportID ViewportIdentifier // 対象のビューポート（ViewportSet, ViewportRemoveの場合のみ）
+	Viewport   Viewport           // ビューポートの設定（ViewportSetの場合のみ）
+}
+
+// 描画の指示の種類の列挙型です
+type DirectionCode int8
+
+// DirectionCode型の値
+const (
+	SpritePut        DirectionCode = iota // スプライトを追加・更新する
+	SpriteRemove                          // スプライトを削除する
+	SpriteHide                            // スプライトを非表示にする
+	SpriteShow                            // スプライトを表示する
+	SpriteMove                            // スプライトを別のレイヤーに移動する
+	LayerClear                            // レイヤーのスプライトを全て削除する
+	LayerRemove                           // レイヤーを削除する
+	EmitterStart                          // パーティクルの連続した放出を開始する
+	EmitterStop                           // パーティクルの連続した放出を停止する（放出済みの粒子は残る）
+	EmitterBurst                          // パーティクルを一度に放出する
+	LayerAdd                              // レイヤーを追加する（追加済みなら設定を更新する）
+	LayerSetProperty                      // レイヤーの設定を更新する
+	TransitionStart                       // 場面を切り替える画面効果を開始する
+	CaptureStart                          // 画面の保存を開始する
+	CaptureStop                           // 記録中の画面の保存を打ち切ってファイルに書き出す
+	ImagePut                              // 実行時に作成した画像をスプライト画像として登録・更新する
+	ImageCompose                          // スプライトを重ねてスプライト画像を作成する
+	ImageRemove                           // スプライト画像の登録を取り消す
+	AssetLoad                             // 名前を付けて画像ファイルを読み込む（読み込み済みなら参照を増やす）
+	AssetRelease                          // 名前で読み込んだ画像の参照を減らす
+	AssetUnload                           // 名前で読み込んだ画像を参照の数に関わらず破棄する
+	ViewportSet                           // ビューポートを追加・更新する
+	ViewportRemove                        // ビューポートを削除する
+)
+
+// PutSpriteは、スプライトを追加・更新する指示を作成します
+// 指示にはスプライトの複製を持たせるため、呼び出し元のスプライトはそのまま使い続けることができます。
+func PutSprite(sprite *Sprite) Direction {
+	return Direction{Code: SpritePut, Sprite: sprite.Clone(), SpriteID: sprite.Id, LayerID: sprite.LayerID}
+}
+
+// RemoveSpriteは、スプライトを削除する指示を作成します
+func RemoveSprite(id SpriteIdentifier) Direction {
+	return Direction{Code: SpriteRemove, SpriteID: id}
+}
+
+// HideSpriteは、スプライトを非表示にする指示を作成します
+func HideSprite(id SpriteIdentifier) Direction {
+	return Direction{Code: SpriteHide, SpriteID: id}
+}
+
+// ShowSpriteは、非表示にしたスプライトを表示する指示を作成します
+func ShowSprite(id SpriteIdentifier) Direction {
+	return Direction{Code: SpriteShow, SpriteID: id}
+}
+
+// MoveSpriteは、スプライトを別のレイヤーに移動する指示を作成します
+func MoveSprite(id SpriteIdentifier, layerID LayerIdentifier) Direction {
+	return Direction{Code: SpriteMove, SpriteID: id, LayerID: layerID}
+}
+
+// ClearLayerは、レイヤーのスプライトを全て削除する指示を作成します
+func ClearLayer(layerID LayerIdentifier) Direction {
+	return Direction{Code: LayerClear, LayerID: layerID}
+}
+
+// RemoveLayerは、レイヤーをスプライトごと削除する指示を作成します
+func RemoveLayer(layerID LayerIdentifier) Direction {
+	return Direction{Code: LayerRemove, LayerID: layerID}
+}
+
+// StartEmitterは、パーティクルの連続した放出を開始する指示を作成します
+func StartEmitter(id SpriteIdentifier) Direction {
+	return Direction{Code: EmitterStart, SpriteID: id}
+}
+
+// StopEmitterは、パーティクルの連続した放出を停止する指示を作成します
+func StopEmitter(id SpriteIdentifier) Direction {
+	return Direction{Code: EmitterStop, SpriteID: id}
+}
+
+// BurstEmitterは、パーティクルをcount個まとめて放出する指示を作成します
+func BurstEmitter(id SpriteIdentifier, count int) Direction {
+	return Direction{Code: EmitterBurst, SpriteID: id, Count: count}
+}
+
+// AddLayerは、レイヤーを設定と共に追加する指示を作成します
+func AddLayer(layerID LayerIdentifier, property LayerProperty) Direction {
+	return Direction{Code: LayerAdd, LayerID: layerID, Layer: property}
+}
+
+// SetLayerPropertyは、レイヤーの設定を更新する指示を作成します
+func SetLayerProperty(layerID LayerIdentifier, property LayerProperty) Direction {
+	return Direction{Code: LayerSetProperty, LayerID: layerID, Layer: property}
+}
+
+// StartTransitionは、場面を切り替える画面効果を開始する指示を作成します。
+// この指示の後に送った指示が、切り替え後の画面として表示されます。
+func StartTransition(transition Transition) Direction {
+	return Direction{Code: TransitionStart, Transition: transition}
+}
+
+// SaveScreenshotは、次に書き出す画面をPNGに保存する指示を作成します
+func SaveScreenshot(filename string) Direction {
+	return Direction{Code: CaptureStart, Capture: Capture{Filename: filename, Format: CapturePNG}}
+}
+
+// StartCaptureは、画面の記録を開始する指示を作成します
+func StartCapture(capture Capture) Direction {
+	return Direction{Code: CaptureStart, Capture: capture}
+}
+
+// StopCaptureは、記録中の画面の保存を打ち切る指示を作成します
+func StopCapture() Direction {
+	return Direction{Code: CaptureStop}
+}
+
+// PutImageは、画像をスプライト画像として登録・更新する指示を作成します
+func PutImage(id ImageIdentifier, img image.Image) Direction {
+	return Direction{Code: ImagePut, Image: GeneratedImage{ID: id, Image: img}}
+}
+
+// PutImageRGBAは、RGBAの画素をスプライト画像として登録・更新する指示を作成します
+func PutImageRGBA(id ImageIdentifier, pixels []byte, width, height int32) Direction {
+	return Direction{Code: ImagePut, Image: GeneratedImage{ID: id, Pixels: pixels, Width: width, Height: height}}
+}
+
+// ComposeImageは、スプライトを重ねてスプライト画像を作成する指示を作成します
+func ComposeImage(composition ImageComposition) Direction {
+	return Direction{Code: ImageCompose, Compose: composition}
+}
+
+// RemoveImageは、スプライト画像の登録を取り消す指示を作成します
+func RemoveImage(id ImageIdentifier) Direction {
+	return Direction{Code: ImageRemove, Image: GeneratedImage{ID: id}}
+}
+
+// LoadAssetは、名前を付けて画像ファイルを読み込む指示を作成します（rectが空ならファイル全体）
+func LoadAsset(name, filename string, rect Rect) Direction {
+	return Direction{Code: AssetLoad, Asset: AssetRequest{Name: name, Filename: filename, Rect: rect}}
+}
+
+// ReleaseAssetは、名前で読み込んだ画像の参照を減らす指示を作成します
+func ReleaseAsset(name string) Direction {
+	return Direction{Code: AssetRelease, Asset: AssetRequest{Name: name}}
+}
+
+// UnloadAssetは、名前で読み込んだ画像を破棄する指示を作成します
+func UnloadAsset(name string) Direction {
+	return Direction{Code: AssetUnload, Asset: AssetRequest{Name: name}}
+}
+
+// SetViewportは、ビューポートを追加・更新する指示を作成します
+func SetViewport(id ViewportIdentifier, viewport Viewport) Direction {
+	return Direction{Code: ViewportSet, ViewportID: id, Viewport: viewport}
+}
+
+// RemoveViewportは、ビューポートを削除する指示を作成します
+func RemoveViewport(id ViewportIdentifier) Direction {
+	return Direction{Code: ViewportRemove, ViewportID: id}
+}
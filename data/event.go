@@ -8,11 +8,13 @@ import (
 
 //Eventは、マウス、キーボードなどからの入力情報です。
 type Event struct {
-	Device   Device    // 入力機器
-	Code     EventCode // 動作の種類
-	Keyboard           // キーボード
-	Mouse              // マウス
-	Joypad             // ジョイパッド
+	Device    Device    // 入力機器
+	Code      EventCode // 動作の種類
+	Keyboard            // キーボード
+	Mouse               // マウス
+	Joypad              // ジョイパッド
+	Tick                // フレームの進行
+	Collision           // スプライトの接触
 }
 
 func (event *Event) String() string {
@@ -35,6 +37,8 @@ const (
 	DeviceKeyboard               // キーボード
 	DeviceMouse                  // マウス
 	DeviceJoypad                 // ジョイパッド
+	DeviceRenderer               // 画面の書き出し（Rendererが発生させるイベント）
+	DeviceClock                  // フレームの進行（Pilotが更新ごとに発生させるイベント）
 )
 
 // 動作の種類の列挙型です
@@ -58,6 +62,20 @@ const (
 	KeyPressOff                         // 離した時
 	KeyPressOn                          // 押した時
 	KeyPressRepeat                      // キーを押し続けている時
+	TransitionEnd                       // 場面を切り替える画面効果が終わった
+	FrameTick                           // 更新を行った（Appが受け取れない間の更新は一つにまとめる）
+	CaptureEnd                          // 画面の保存が終わった
+	CaptureFailed                       // 画面の保存に失敗した
+	SpriteEnter                         // カーソルがスプライトに重なった
+	SpriteLeave                         // カーソルがスプライトから外れた
+	SpriteDown                          // スプライトの上でボタンを押した
+	SpriteUp                            // スプライトの上でボタンを離した
+	SpriteClick                         // 同じスプライトの上でボタンを押して離した
+	SpriteDragStart                     // スプライトの上で押したボタンを押したまま移動し始めた
+	SpriteDragEnd                       // スプライトのドラッグを終えた（Mouse.Spriteはドラッグしたスプライト）
+	CollisionEnter                      // スプライトが接触し始めた
+	CollisionStay                       // スプライトが接触し続けている（Collider.Stayを指定した場合のみ、更新ごと）
+	CollisionExit                       // スプライトが離れた
 )
 
 // キーボードからの入力情報です。
@@ -325,10 +343,29 @@ const (
 
 // マウスからの入力情報です
 type Mouse struct {
-	X     int32 // 現在座標X
-	Y     int32 // 現在座標Y
-	MoveX int32 // X移動量
-	MoveY int32 // Y移動量
+	X      int32            // 現在座標X
+	Y      int32            // 現在座標Y
+	MoveX  int32            // X移動量
+	MoveY  int32            // Y移動量
+	Sprite SpriteIdentifier // 対象のスプライト（Sprite〜のイベントの場合のみ）
+	Button MouseButton      // 操作したボタン（SpriteDown, SpriteUp, SpriteClick, SpriteDrag〜の場合のみ）
+}
+
+// マウスのボタンの列挙型です
+type MouseButton int8
+
+// MouseButton型の値
+const (
+	MouseButtonNone  MouseButton = iota // ボタンなし
+	MouseButtonLeft                     // 左ボタン
+	MouseButtonRight                    // 右ボタン
+)
+
+// フレームの進行の情報です。
+type Tick struct {
+	Frame   uint64 // 最後に行った更新の通し番号
+	Delta   uint32 // 前回送ったFrameTickからの経過時間（ミリ秒）
+	Updates uint32 // まとめた更新の回数
 }
 
 // ジョイパッドからの入力情報です。
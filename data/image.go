@@ -0,0 +1,23 @@
+package data
+
+import "image"
+
+// GeneratedImageは、Appが実行時に作成してスプライト画像として登録する画像です。
+// 送信した後は、ImageやPixelsの内容を変更しないでください。
+type GeneratedImage struct {
+	ID     ImageIdentifier // 登録するスプライト画像のID（登録済みなら画像を置き換える）
+	Image  image.Image     // 登録する画像（nilならPixelsを使う）
+	Pixels []byte          // RGBAの順に1ピクセル4バイトで並べた画素（行の間に隙間を空けない）
+	Width  int32           // Pixelsの幅
+	Height int32           // Pixelsの高さ
+}
+
+// ImageCompositionは、スプライトを重ねて新しいスプライト画像を作成する設定です。
+// ミニマップや焼き込んだ装飾など、毎フレーム書き出す必要のない画像を作るために使います。
+type ImageComposition struct {
+	ID         ImageIdentifier // 作成するスプライト画像のID（登録済みなら画像を置き換える）
+	Width      int32           // 画像の幅
+	Height     int32           // 画像の高さ
+	Background Color           // 背景色（透明にする場合はAを0にする）
+	Sprites    []Sprite        // 重ねるスプライト（座標は画像の左上が原点。Priorityの小さい順に重ねる）
+}
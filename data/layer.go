@@ -0,0 +1,31 @@
+package data
+
+// LayerPropertyは、レイヤー全体の表示に関する設定です。
+// Sort以外はレイヤーを画面に重ねる際に適用されるため、レイヤーの中のスプライトを書き直す必要はありません。
+type LayerProperty struct {
+	Name   string    // レイヤーの名前（デバッグ表示などに使用）
+	Hidden bool      // trueなら画面に重ねない
+	Alpha  uint8     // 不透明度（0で透明、255で不透明）
+	Tint   Color     // 色の乗算（RGBのみ使用。白で元の色のまま）
+	Blend  BlendMode // 画面に重ねる際の合成方法
+	Clip   Rect      // 表示する範囲（幅か高さが0なら全体を表示する）
+	Sort   SortMode  // Priorityが同じスプライトを重ねる順
+}
+
+// スプライトを重ねる順の列挙型
+type SortMode int8
+
+// SortMode型の値
+const (
+	SortPriority SortMode = iota // Priorityの順。同じ場合はIDの順（毎回同じ順になる）
+	SortY                        // Priorityの順。同じ場合は下端（UsePivotがtrueなら基準点）が上にあるものから順
+)
+
+// NewLayerPropertyは、元の見た目のまま表示するレイヤーの設定を作成します
+// 不透明度や色の乗算は0もそのまま使うため、LayerProperty{}のように作成した場合は表示されません。
+func NewLayerProperty() LayerProperty {
+	return LayerProperty{
+		Alpha: 255,
+		Tint:  Color{255, 255, 255, 255},
+	}
+}
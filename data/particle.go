@@ -0,0 +1,43 @@
+package data
+
+// Emitterは、パーティクル（粒子）を放出する発生源の設定です。
+// Sprite.KindにKindEmitterを指定して送信すると、Renderer側で粒子の発生・移動・消滅を毎フレーム計算します。
+// 粒子はDistRectの範囲内のランダムな位置から放出されます。
+type Emitter struct {
+	ImageIDs       []ImageIdentifier // 粒子の画像（複数ならランダムに選ぶ。空なら矩形を塗る）
+	ParticleWidth  int32             // 粒子の幅
+	ParticleHeight int32             // 粒子の高さ
+	Rate           float64           // 1秒あたりに放出する数
+	Burst          int               // 最初に一度に放出する数
+	MaxParticles   int               // 同時に存在できる粒子の上限（0で無制限）
+	Stopped        bool              // trueなら最初は連続して放出しない（EmitterStartで開始する）
+	Lifetime       Range             // 寿命（ミリ秒）
+	Speed          Range             // 放出時の速さ（ピクセル/秒）
+	Direction      Range             // 放出する方向（度。0で右、90で下）
+	Spin           Range             // 回転の速さ（度/秒）
+	GravityX       float64           // 横方向の加速度（ピクセル/秒^2）
+	GravityY       float64           // 縦方向の加速度（ピクセル/秒^2）
+	Color          []ColorKey        // 寿命に対する色の変化（空なら白）
+	Alpha          []ValueKey        // 寿命に対する不透明度（0〜1）の変化（空なら1）
+	Scale          []ValueKey        // 寿命に対する拡大率の変化（空なら1）
+}
+
+// 最小値と最大値の範囲（この範囲でランダムに決める）
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// 寿命の割合（0〜1）に対する色の変化の基準点
+type ColorKey struct {
+	Time   float64 // 寿命の割合
+	Color  Color   // 色
+	Easing Easing  // 次の基準点までの緩急のつけ方
+}
+
+// 寿命の割合（0〜1）に対する値の変化の基準点
+type ValueKey struct {
+	Time   float64 // 寿命の割合
+	Value  float64 // 値
+	Easing Easing  // 次の基準点までの緩急のつけ方
+}
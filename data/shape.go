@@ -0,0 +1,31 @@
+package data
+
+// Shapeは、スプライトとして書き出す図形の情報です。
+// Sprite.KindにKindShapeを指定した場合、DistRectを基準に書き出されます。
+// 拡大率・回転・裏返し・不透明度・色の乗算・合成方法は画像のスプライトと同様に反映されます。
+type Shape struct {
+	Type      ShapeType // 図形の種類
+	Color     Color     // 色（Aは不透明度）
+	Filled    bool      // trueなら塗りつぶす。falseなら輪郭線を書く
+	Thickness int32     // 線の太さ（0は1として扱う）。輪郭線はDistRectの内側に書く
+	Radius    int32     // 角の丸みの半径（ShapeRoundRectの場合のみ）
+	Points    []Point   // 頂点（ShapeLine, ShapePolygonの場合のみ）。DistRectの左上からの相対座標
+}
+
+// 図形の種類の列挙型
+type ShapeType int8
+
+// ShapeType型の値
+const (
+	ShapeRect      ShapeType = iota // DistRectと同じ矩形
+	ShapeRoundRect                  // 角の丸い矩形
+	ShapeCircle                     // DistRectに内接する円（楕円）
+	ShapeLine                       // Pointsを順に結ぶ線
+	ShapePolygon                    // Pointsを頂点とする多角形
+)
+
+// 座標
+type Point struct {
+	X int32
+	Y int32
+}
@@ -16,6 +16,7 @@ type Sound struct {
 	PlayType PlayType
 	Music    *mix.Music
 	Effect   *mix.Chunk
+	Filename string // 読み込んだファイル（変更を検知して読み込み直すために使う）
 }
 
 // サウンドIDの列挙型（値はApp側で設定する）
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"math"
 	"sync"
 
 	"github.com/rs/xid"
@@ -12,26 +13,153 @@ type Sprite struct {
 	sync.Mutex
 	LayerID    LayerIdentifier  // スプライトが書き出されるLayerのID
 	Id         SpriteIdentifier // 個別のスプライトインスタンスの固有ID
+	Parent     SpriteIdentifier // 親のスプライト（設定すると位置・回転・拡大率・裏返し・不透明度を親を基準とした値とする）
+	Kind       SpriteKind       // スプライトの種類
 	Updated    bool             // 更新フラグ。App側で管理するために使用
+	Hidden     bool             // trueなら書き出さない
+	Pickable   bool             // trueならカーソルの当たり判定とスプライトのイベントの対象にする
 	DistRect   Rect             // 書き出し先の矩形
-	Priority   int8             // 書き出しの優先度（大きいほど上にくる）
+	SubPixel   FPoint           // 位置の小数部分（DistRectのLeft, Topに加える。SetPositionで設定し、Left, Topを直接変えた向きでは使わない）
+	Pivot      FPoint           // 基準点（幅と高さに対する割合。UsePivotがtrueなら位置と回転・拡大の中心になる）
+	UsePivot   bool             // trueならRotateのCenterX, CenterYの代わりにPivotを使う
+	Priority   int32            // 書き出しの優先度（大きいほど上にくる。同じ場合はレイヤーのSortに従う）
 	SrcImageID ImageIdentifier  // スプライト画像のリソースID
 	Rotate     Rotate           // 回転
 	Flip       Flip             // 裏返し
+	Slice      SliceMode        // 9分割画像の書き出し方（スプライト画像に枠が設定されている場合のみ）
+	Alpha      uint8            // 不透明度（0で透明、255で不透明）
+	ColorMod   Color            // 色の乗算（RGBのみ使用。白で元の色のまま）
+	Blend      BlendMode        // 合成方法
+	ScaleX     float64          // 横方向の拡大率（回転の中心を基準に拡大する）
+	ScaleY     float64          // 縦方向の拡大率（回転の中心を基準に拡大する）
+	Tweens     []Tween          // 実行するTween（nilでなければ実行中のTweenを置き換え、空なら停止する）
+	Text       Text             // 書き出す文字列（KindTextの場合のみ）
+	Shape      Shape            // 書き出す図形（KindShapeの場合のみ）
+	Emitter    Emitter          // パーティクルの発生源の設定（KindEmitterの場合のみ）
+	Collider   Collider         // 当たり判定
+	subPixelAt Point            // SubPixelを設定した時のDistRectのLeft, Top
 }
 
+// NewSpriteは、元の見た目のまま書き出すスプライトを作成します
+// 不透明度や拡大率、色の乗算は0もそのまま使うため、Sprite{}のように作成した場合は書き出されません。
 func NewSprite(layerID LayerIdentifier) Sprite {
 	guid := SpriteIdentifier(xid.New())
-	sprite := Sprite{
-		LayerID: layerID,
-		Id:      guid,
+	return Sprite{
+		LayerID:  layerID,
+		Id:       guid,
+		Alpha:    255,
+		ColorMod: Color{255, 255, 255, 255},
+		ScaleX:   1,
+		ScaleY:   1,
 	}
-	return sprite
+}
+
+// Positionは、小数部分を含めた位置を返します（UsePivotがtrueなら基準点の位置）
+// SetPositionの後にDistRectのLeft, Topを直接変えた場合、その向きの小数部分は古い値のため使いません。
+func (sprite *Sprite) Position() FPoint {
+	pos := FPoint{X: float64(sprite.DistRect.Left), Y: float64(sprite.DistRect.Top)}
+	if sprite.DistRect.Left == sprite.subPixelAt.X {
+		pos.X += sprite.SubPixel.X
+	}
+	if sprite.DistRect.Top == sprite.subPixelAt.Y {
+		pos.Y += sprite.SubPixel.Y
+	}
+	return pos
+}
+
+// SetPositionは、小数を含む位置を整数部分（DistRectのLeft, Top）と小数部分（SubPixel）に分けて設定します
+func (sprite *Sprite) SetPosition(x, y float64) {
+	fx, fy := math.Floor(x), math.Floor(y)
+	sprite.DistRect.Left, sprite.DistRect.Top = int32(fx), int32(fy)
+	sprite.SubPixel = FPoint{X: x - fx, Y: y - fy}
+	sprite.subPixelAt = Point{X: sprite.DistRect.Left, Y: sprite.DistRect.Top}
+}
+
+// SetPivotは、基準点を幅と高さに対する割合で設定します（0.5, 0.5で中央、0.5, 1で下端の中央）
+func (sprite *Sprite) SetPivot(x, y float64) {
+	sprite.Pivot = FPoint{X: x, Y: y}
+	sprite.UsePivot = true
+}
+
+// Cloneは、排他制御用のMutexを除いたスプライトの複製を作成します
+func (sprite *Sprite) Clone() *Sprite {
+	return &Sprite{
+		LayerID:    sprite.LayerID,
+		Id:         sprite.Id,
+		Parent:     sprite.Parent,
+		Kind:       sprite.Kind,
+		Updated:    sprite.Updated,
+		Hidden:     sprite.Hidden,
+		Pickable:   sprite.Pickable,
+		DistRect:   sprite.DistRect,
+		SubPixel:   sprite.SubPixel,
+		subPixelAt: sprite.subPixelAt,
+		Pivot:      sprite.Pivot,
+		UsePivot:   sprite.UsePivot,
+		Priority:   sprite.Priority,
+		SrcImageID: sprite.SrcImageID,
+		Rotate:     sprite.Rotate,
+		Flip:       sprite.Flip,
+		Slice:      sprite.Slice,
+		Alpha:      sprite.Alpha,
+		ColorMod:   sprite.ColorMod,
+		Blend:      sprite.Blend,
+		ScaleX:     sprite.ScaleX,
+		ScaleY:     sprite.ScaleY,
+		Tweens:     sprite.Tweens,
+		Text:       sprite.Text,
+		Shape:      sprite.Shape,
+		Emitter:    sprite.Emitter,
+		Collider:   sprite.Collider,
+	}
+}
+
+// HasParentは、親のスプライトが設定されているか否かを返します
+func (sprite *Sprite) HasParent() bool {
+	return sprite.Parent != SpriteIdentifier{}
 }
 
 // スプライトID
 type SpriteIdentifier xid.ID
 
+// スプライトの種類の列挙型
+type SpriteKind int8
+
+// SpriteKind型の値
+const (
+	KindImage   SpriteKind = iota // スプライト画像を書き出す
+	KindText                      // 文字列を書き出す
+	KindShape                     // 図形を書き出す
+	KindEmitter                   // パーティクルを放出して書き出す
+)
+
+// 色
+type Color struct {
+	R uint8
+	G uint8
+	B uint8
+	A uint8
+}
+
+// 合成方法の列挙型
+// 合成は書き出し先のレイヤーの中で行われます。
+type BlendMode int8
+
+// BlendMode型の値
+const (
+	BlendAlpha    BlendMode = iota // 不透明度による通常の合成
+	BlendAdd                       // 加算（発光の表現など）
+	BlendModulate                  // 色の乗算（不透明度は変えない）
+	BlendMultiply                  // 乗算（不透明度を考慮する）
+	BlendNone                      // 合成せずに上書き
+)
+
+// 小数を含む座標
+type FPoint struct {
+	X float64
+	Y float64
+}
+
 // 矩形
 type Rect struct {
 	Left   int32
@@ -52,8 +180,8 @@ func (rect *Rect) ToSdlRect() *sdl.Rect {
 // 描画レイヤーの識別子の列挙型（Viewで定義しておくのが望ましい）
 type LayerIdentifier int8
 
-// スプライト画像の識別子（Viewで定義しておくのが望ましい）
-type ImageIdentifier int8
+// スプライト画像の識別子（Viewで定義しておくのが望ましい。名前で読み込んだ画像には65536以上の値が割り当てられる）
+type ImageIdentifier int32
 
 // 書き出しを行うメソッド
 type DrawMethod *func() error
@@ -62,15 +190,41 @@ type DrawMethod *func() error
 type SpriteImage struct {
 	SpriteTable *sdl.Texture // スプライトテーブル（スプライト並べた画像）
 	Rect        Rect         // スプライトテーブル上の矩形
+	Slice       Insets       // 9分割する際の枠の幅（全て0なら分割しない）
+	Type        ImageType    // 画像の取得方法
 }
 
+// 矩形の内側の余白（9分割画像の枠の幅）
+type Insets struct {
+	Left   int32
+	Top    int32
+	Right  int32
+	Bottom int32
+}
+
+// IsZeroは、余白が全て0か否かを返します
+func (insets Insets) IsZero() bool {
+	return insets == Insets{}
+}
+
+// 9分割画像の書き出し方の列挙型
+// 四隅はそのままの大きさで書き出し、辺と中央をDistRectに合わせて伸縮します。
+type SliceMode int8
+
+// SliceMode型の値
+const (
+	SliceNone    SliceMode = iota // 分割せずに画像全体を伸縮する
+	SliceStretch                  // 辺と中央を引き伸ばす
+	SliceTile                     // 辺と中央を元の大きさで敷き詰める
+)
+
 // イメージの取得方法
 type ImageType int8
 
 // ImageType型の値
 const (
-	Resource  ImageType = iota // リソースリストから取得
-	Generated                  // Viewが生成した画像を取得
+	Resource  ImageType = iota // リソースリストから取得（スプライトテーブルを複数の画像で共有する）
+	Generated                  // Viewが生成した画像を取得（画像ごとにテクスチャを持つ）
 )
 
 // 回転のパラメータ
@@ -81,11 +235,13 @@ type Rotate struct {
 }
 
 // 裏返しの列挙型
+// 値はビットフラグで、Horizontal | Verticalのように組み合わせることができます。
 type Flip int8
 
 // Flip型の値
 const (
-	NoFlip     Flip = iota // 裏返しなし
-	Horizontal             // 横方向
-	Vertical               // 縦方向
+	NoFlip     Flip = 0                     // 裏返しなし
+	Horizontal Flip = 1 << 0                // 横方向
+	Vertical   Flip = 1 << 1                // 縦方向
+	FlipBoth        = Horizontal | Vertical // 横と縦の両方
 )
@@ -0,0 +1,50 @@
+package data
+
+// Textは、スプライトとして書き出す文字列の情報です。
+// Sprite.KindにKindTextを指定した場合、DistRectの中に書き出されます。
+type Text struct {
+	FontID        FontIdentifier // 書き出しに使うフォントのID
+	Content       string         // 書き出す文字列（改行で行を分ける）
+	Color         Color          // 文字色
+	Align         TextAlign      // 横方向の揃え
+	VerticalAlign VerticalAlign  // 縦方向の揃え
+	LineSpacing   int32          // 行間（フォントの行の高さに加えるピクセル数）
+	Wrap          bool           // trueならDistRectの幅で折り返す
+	Outline       int32          // 縁取りの太さ（0で縁取りなし）
+	OutlineColor  Color          // 縁取りの色
+	ShadowX       int32          // 影の横方向のずれ（ShadowX, ShadowYともに0で影なし）
+	ShadowY       int32          // 影の縦方向のずれ
+	ShadowColor   Color          // 影の色
+}
+
+// NewTextは、白色の文字列を作成します
+func NewText(fontID FontIdentifier, content string) Text {
+	return Text{
+		FontID:  fontID,
+		Content: content,
+		Color:   Color{255, 255, 255, 255},
+	}
+}
+
+// フォントの識別子（Viewで定義しておくのが望ましい）
+type FontIdentifier int8
+
+// 横方向の揃えの列挙型
+type TextAlign int8
+
+// TextAlign型の値
+const (
+	AlignLeft   TextAlign = iota // 左揃え
+	AlignCenter                  // 中央揃え
+	AlignRight                   // 右揃え
+)
+
+// 縦方向の揃えの列挙型
+type VerticalAlign int8
+
+// VerticalAlign型の値
+const (
+	AlignTop    VerticalAlign = iota // 上揃え
+	AlignMiddle                      // 中央揃え
+	AlignBottom                      // 下揃え
+)
@@ -0,0 +1,35 @@
+package data
+
+// Transitionは、場面を切り替える際の画面効果です。
+// 開始した時点で表示されている画面から、その後に書き出される画面へDurationの間に切り替えます。
+type Transition struct {
+	Type      TransitionType // 効果の種類
+	Duration  uint32         // 切り替えにかかる時間（ミリ秒）
+	Easing    Easing         // 進行の仕方
+	Color     Color          // 途中で経由する色（TransitionFadeの場合のみ）
+	Direction WipeDirection  // 拭き取る向き（TransitionWipeの場合のみ）
+	BlockSize int32          // 最も粗い時のモザイクの一辺（TransitionMosaicの場合のみ。0なら32）
+}
+
+// 画面効果の種類の列挙型
+type TransitionType int8
+
+// TransitionType型の値
+const (
+	TransitionFade      TransitionType = iota // 指定した色に溶暗してから溶明する
+	TransitionCrossfade                       // 前の画面を徐々に透明にする
+	TransitionWipe                            // 前の画面を一方向から拭き取る
+	TransitionIris                            // 中央から広がる円の中に次の画面を表示する
+	TransitionMosaic                          // 前の画面を粗くしてから次の画面を細かくする
+)
+
+// 拭き取る向きの列挙型
+type WipeDirection int8
+
+// WipeDirection型の値
+const (
+	WipeToRight WipeDirection = iota // 左から右へ
+	WipeToLeft                       // 右から左へ
+	WipeToDown                       // 上から下へ
+	WipeToUp                         // 下から上へ
+)
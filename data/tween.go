@@ -0,0 +1,60 @@
+package data
+
+// Tweenは、スプライトのプロパティを時間の経過に合わせて変化させる指示です。
+// Sprite.Tweensに設定して送信すると、Renderer側で毎フレーム値を更新します。
+type Tween struct {
+	Property    TweenProperty // 変化させるプロパティ
+	From        float64       // 開始値
+	To          float64       // 終了値
+	FromCurrent bool          // trueならFromを使わず、開始時点の値から変化させる
+	Duration    uint32        // 変化にかける時間（ミリ秒）
+	Delay       uint32        // 変化を始めるまでの待ち時間（ミリ秒）
+	Easing      Easing        // 緩急のつけ方
+	Yoyo        bool          // trueなら終了値に達した後、開始値まで戻る
+	Repeat      int           // 繰り返す回数（-1で無限に繰り返す）
+	Next        *Tween        // 終了後に続けて実行するTween
+}
+
+// Tweenで変化させるプロパティの列挙型
+type TweenProperty int8
+
+// TweenProperty型の値
+const (
+	TweenX      TweenProperty = iota // 書き出し先の矩形のX座標
+	TweenY                           // 書き出し先の矩形のY座標
+	TweenWidth                       // 書き出し先の矩形の幅
+	TweenHeight                      // 書き出し先の矩形の高さ
+	TweenAngle                       // 回転角度
+	TweenAlpha                       // 不透明度（0〜255）
+	TweenScale                       // 縦横の拡大率
+	TweenScaleX                      // 横方向の拡大率
+	TweenScaleY                      // 縦方向の拡大率
+)
+
+// 緩急のつけ方（イージング）の列挙型
+type Easing int8
+
+// Easing型の値
+const (
+	Linear          Easing = iota // 等速
+	EaseInQuad                    // 二次関数で加速
+	EaseOutQuad                   // 二次関数で減速
+	EaseInOutQuad                 // 二次関数で加速して減速
+	EaseInCubic                   // 三次関数で加速
+	EaseOutCubic                  // 三次関数で減速
+	EaseInOutCubic                // 三次関数で加速して減速
+	EaseInSine                    // 正弦波で加速
+	EaseOutSine                   // 正弦波で減速
+	EaseInOutSine                 // 正弦波で加速して減速
+	EaseInExpo                    // 指数関数で加速
+	EaseOutExpo                   // 指数関数で減速
+	EaseInOutExpo                 // 指数関数で加速して減速
+	EaseInBack                    // 一度戻ってから加速
+	EaseOutBack                   // 行き過ぎてから戻る
+	EaseInOutBack                 // 戻って加速し、行き過ぎてから戻る
+	EaseInElastic                 // ばねのように振動しながら加速
+	EaseOutElastic                // ばねのように振動しながら減速
+	EaseInBounce                  // 跳ねながら加速
+	EaseOutBounce                 // 跳ねながら減速
+	EaseInOutBounce               // 跳ねながら加速して減速
+)
@@ -0,0 +1,65 @@
+package data
+
+// ビューポートの識別子（IDの小さい順に画面に重ねる）
+type ViewportIdentifier int8
+
+// Viewportは、レイヤーを画面の一部に書き出す表示領域です。
+// 一つでも設定すると、画面にはレイヤーをそのまま重ねる代わりに、ビューポートをIDの順に重ねます。
+// Cameraの範囲のレイヤーを、画面のScreenの範囲に拡大・縮小して書き出します。
+// ビューポートではレイヤーのClipは使いません。
+type Viewport struct {
+	Camera     Rect              // 書き出すレイヤーの範囲（スプライトの座標）
+	Screen     Rect              // 書き出す画面の範囲（論理解像度の座標）
+	Layers     []LayerIdentifier // 書き出すレイヤー（空なら全てのレイヤー）
+	Background Color             // 背景色（不透明度が0なら下のビューポートが透けて見える）
+	Pickable   bool              // trueならカーソルの当たり判定とスプライトのイベントの対象にする
+}
+
+// NewViewportは、cameraの範囲を画面のscreenの範囲に書き出す、カーソルの当たり判定の対象のビューポートを作成します
+func NewViewport(camera, screen Rect) Viewport {
+	return Viewport{
+		Camera:     camera,
+		Screen:     screen,
+		Background: Color{0, 0, 0, 255},
+		Pickable:   true,
+	}
+}
+
+// Containsは、ビューポートがレイヤーを書き出すか否かを返します
+func (viewport *Viewport) Contains(layerID LayerIdentifier) bool {
+	if len(viewport.Layers) == 0 {
+		return true
+	}
+	for _, id := range viewport.Layers {
+		if id == layerID {
+			return true
+		}
+	}
+	return false
+}
+
+// ToCameraは、画面（論理解像度）の座標を、ビューポートのカメラの座標（スプライトの座標）に変換します。
+// 座標がビューポートの外にある場合はfalseを返します。
+func (viewport *Viewport) ToCamera(x, y float64) (float64, float64, bool) {
+	screen, camera := viewport.Screen, viewport.Camera
+	if screen.Width <= 0 || screen.Height <= 0 ||
+		x < float64(screen.Left) || y < float64(screen.Top) ||
+		x >= float64(screen.Left+screen.Width) || y >= float64(screen.Top+screen.Height) {
+		return 0, 0, false
+	}
+	cx := float64(camera.Left) + (x-float64(screen.Left))*float64(camera.Width)/float64(screen.Width)
+	cy := float64(camera.Top) + (y-float64(screen.Top))*float64(camera.Height)/float64(screen.Height)
+	return cx, cy, true
+}
+
+// ToScreenは、ビューポートのカメラの座標（スプライトの座標）を、画面（論理解像度）の座標に変換します。
+// ToCameraと異なり、ビューポートの外になる座標もそのまま変換します。
+func (viewport *Viewport) ToScreen(x, y float64) (float64, float64) {
+	screen, camera := viewport.Screen, viewport.Camera
+	if camera.Width <= 0 || camera.Height <= 0 {
+		return float64(screen.Left), float64(screen.Top)
+	}
+	sx := float64(screen.Left) + (x-float64(camera.Left))*float64(screen.Width)/float64(camera.Width)
+	sy := float64(screen.Top) + (y-float64(camera.Top))*float64(screen.Height)/float64(camera.Height)
+	return sx, sy
+}
@@ -0,0 +1,588 @@
+package pilot
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/img"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// 名前で登録したスプライト画像に割り当てるIDの最初の値（Appが定数で定義するIDと重ならないようにする）
+const firstAssetImageID data.ImageIdentifier = 1 << 16
+
+/*
+AssetReportは、読み込み済みの画像の一覧です。
+*/
+type AssetReport struct {
+	Textures []TextureAssetInfo // 読み込み済みの画像ファイル（ファイル名順）
+	Images   []ImageAssetInfo   // 名前を登録したスプライト画像（名前順）
+	Bytes    int64              // テクスチャの大きさの合計（1ピクセル4バイトとした推定値）
+	Budget   int64              // テクスチャの大きさの上限（0なら無制限）
+}
+
+/*
+TextureAssetInfoは、読み込み済みの画像ファイル一件分の情報です。
+*/
+type TextureAssetInfo struct {
+	Filename string
+	Width    int32
+	Height   int32
+	Bytes    int64
+	Images   int // このファイルから読み込んだ名前付きの画像の数
+	Refs     int // 名前付きの画像の参照の数の合計
+	Sheets   int // AddSpriteImagesで登録したスプライト画像の数
+}
+
+/*
+ImageAssetInfoは、名前を登録したスプライト画像一件分の情報です。
+*/
+type ImageAssetInfo struct {
+	Name     string
+	ID       data.ImageIdentifier
+	Filename string
+	Rect     data.Rect
+	Refs     int
+	Loaded   bool // テクスチャが読み込まれているか否か
+}
+
+/*
+textureAssetは、読み込んだ画像ファイル一件分のテクスチャです。
+*/
+type textureAsset struct {
+	filename string
+	texture  *sdl.Texture
+	mask     *alphaMask // ファイル全体の当たり判定用の画像
+	width    int32
+	height   int32
+	bytes    int64
+	sheets   map[data.ImageIdentifier]data.Rect // AddSpriteImagesで登録したスプライト画像のIDと矩形
+	used     uint64                             // 最後に参照を増減した順番（古いものから破棄する）
+}
+
+/*
+sheetImageは、上限を超えたために破棄した、AddSpriteImagesで登録したスプライト画像です。
+スプライトが再び使う時に読み込み直します。
+*/
+type sheetImage struct {
+	filename string
+	rect     data.Rect
+}
+
+/*
+imageAssetは、名前を付けたスプライト画像です。破棄した後もIDは変わりません。
+*/
+type imageAsset struct {
+	name     string
+	id       data.ImageIdentifier
+	filename string
+	rect     data.Rect
+	refs     int
+	loaded   bool
+}
+
+/*
+assetManagerは、画像ファイルのテクスチャと名前付きのスプライト画像を管理します。
+名前とIDの対応は別のgoroutineから参照されるため、mtxで保護します。
+*/
+type assetManager struct {
+	textures map[string]*textureAsset            // 正規化したファイル名ごとのテクスチャ
+	images   map[string]*imageAsset              // 名前ごとのスプライト画像
+	evicted  map[data.ImageIdentifier]sheetImage // 破棄したAddSpriteImagesのスプライト画像
+	nextID   data.ImageIdentifier
+	bytes    int64
+	budget   int64
+	clock    uint64
+	mtx      sync.Mutex
+}
+
+// newAssetManagerは、空のassetManagerを作成します
+func newAssetManager() *assetManager {
+	return &assetManager{
+		textures: make(map[string]*textureAsset),
+		images:   make(map[string]*imageAsset),
+		evicted:  make(map[data.ImageIdentifier]sheetImage),
+		nextID:   firstAssetImageID,
+	}
+}
+
+// assetKeyは、同じファイルを同じものとみなすためのファイル名を返します
+func assetKey(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filepath.Clean(filename)
+}
+
+// touchは、テクスチャを最後に使ったものとして記録します
+func (manager *assetManager) touch(texture *textureAsset) {
+	manager.clock++
+	texture.used = manager.clock
+}
+
+// imageは、名前のスプライト画像を返します。未登録なら新しいIDを割り当てます
+func (manager *assetManager) image(name string) *imageAsset {
+	asset, ok := manager.images[name]
+	if !ok {
+		asset = &imageAsset{name: name, id: manager.nextID}
+		manager.nextID++
+		manager.images[name] = asset
+	}
+	return asset
+}
+
+/*
+ImageIDは、名前を付けたスプライト画像のIDを返します。まだ読み込んでいない名前にも、読み込んだ時と同じIDを返します。
+別のgoroutineから呼び出すことができます。
+*/
+func (renderer *Renderer) ImageID(name string) data.ImageIdentifier {
+	renderer.assets.mtx.Lock()
+	defer renderer.assets.mtx.Unlock()
+	return renderer.assets.image(name).id
+}
+
+/*
+LoadImageは、画像ファイルの矩形rectの範囲を、名前を付けたスプライト画像として読み込み、参照を一つ増やします。
+rectの幅か高さが0の場合はファイル全体を使います。読み込み済みの名前の場合は参照を増やすだけです。
+同じファイルから読み込んだ画像はテクスチャを共有します。
+*/
+func (renderer *Renderer) LoadImage(name, filename string, rect data.Rect) (data.ImageIdentifier, error) {
+	manager := renderer.assets
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+	asset := manager.image(name)
+	key := assetKey(filename)
+	if texture, ok := manager.textures[key]; ok && asset.loaded && asset.filename == key {
+		want := rect
+		if rect.Width == 0 || rect.Height == 0 {
+			want = data.Rect{Width: texture.width, Height: texture.height}
+		}
+		if si, ok := renderer.SpriteImages[asset.id]; ok && asset.rect == want && si.SpriteTable == texture.texture {
+			asset.refs++
+			manager.touch(texture)
+			return asset.id, nil
+		}
+	}
+	if asset.loaded {
+		// 別の画像に置き換える
+		renderer.unloadImage(asset)
+	}
+	texture, err := renderer.loadTexture(filename)
+	if err != nil {
+		return asset.id, err
+	}
+	if rect.Width == 0 || rect.Height == 0 {
+		rect = data.Rect{Width: texture.width, Height: texture.height}
+	}
+	if rect.Left < 0 || rect.Top < 0 || rect.Left+rect.Width > texture.width || rect.Top+rect.Height > texture.height {
+		renderer.releaseTexture(texture)
+		return asset.id, errors.New(fmt.Sprintf("Invalid image rect:%d,%d,%d,%d", rect.Left, rect.Top, rect.Width, rect.Height))
+	}
+	asset.filename = key
+	asset.rect = rect
+	asset.refs++
+	asset.loaded = true
+	manager.touch(texture)
+	renderer.SpriteImages[asset.id] = &data.SpriteImage{SpriteTable: texture.texture, Rect: rect, Type: data.Resource}
+	renderer.masks[asset.id] = texture.mask.sub(rect)
+	renderer.markImageDirty(asset.id)
+	renderer.enforceBudget()
+	return asset.id, nil
+}
+
+/*
+ReleaseImageは、名前を付けたスプライト画像の参照を一つ減らします。
+参照が無くなった画像は、テクスチャの大きさの合計が上限を超えた時に、使われていない期間が長いものから破棄されます。
+*/
+func (renderer *Renderer) ReleaseImage(name string) {
+	manager := renderer.assets
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+	asset, ok := manager.images[name]
+	if !ok || asset.refs == 0 {
+		return
+	}
+	asset.refs--
+	if texture, ok := manager.textures[asset.filename]; ok {
+		manager.touch(texture)
+	}
+	renderer.enforceBudget()
+}
+
+/*
+UnloadImageは、名前を付けたスプライト画像を参照の数に関わらず破棄します。
+同じファイルから読み込んだ画像が他に無ければ、テクスチャも破棄します。
+破棄した画像を使うスプライトは書き出しの際にエラーとなるため、先に取り除いておく必要があります。
+*/
+func (renderer *Renderer) UnloadImage(name string) {
+	renderer.assets.mtx.Lock()
+	defer renderer.assets.mtx.Unlock()
+	if asset, ok := renderer.assets.images[name]; ok && asset.loaded {
+		renderer.unloadImage(asset)
+	}
+}
+
+/*
+SetTextureBudgetは、読み込んだ画像ファイルのテクスチャの大きさの合計の上限（バイト）を設定します。
+上限を超えた場合は、参照が無く、スプライトからも使われていない画像を古いものから破棄します。0を指定すると無制限です。
+*/
+func (renderer *Renderer) SetTextureBudget(bytes int64) {
+	renderer.assets.mtx.Lock()
+	defer renderer.assets.mtx.Unlock()
+	renderer.assets.budget = bytes
+	renderer.enforceBudget()
+}
+
+/*
+AssetReportは、読み込み済みの画像の一覧を返します。別のgoroutineから呼び出すことができます。
+*/
+func (renderer *Renderer) AssetReport() AssetReport {
+	manager := renderer.assets
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+	report := AssetReport{Bytes: manager.bytes, Budget: manager.budget}
+	textures := make(map[string]*TextureAssetInfo, len(manager.textures))
+	for key, texture := range manager.textures {
+		textures[key] = &TextureAssetInfo{
+			Filename: texture.filename,
+			Width:    texture.width,
+			Height:   texture.height,
+			Bytes:    texture.bytes,
+			Sheets:   len(texture.sheets),
+		}
+	}
+	for _, asset := range manager.images {
+		report.Images = append(report.Images, ImageAssetInfo{
+			Name:     asset.name,
+			ID:       asset.id,
+			Filename: asset.filename,
+			Rect:     asset.rect,
+			Refs:     asset.refs,
+			Loaded:   asset.loaded,
+		})
+		if info, ok := textures[asset.filename]; ok && asset.loaded {
+			info.Images++
+			info.Refs += asset.refs
+		}
+	}
+	for _, info := range textures {
+		report.Textures = append(report.Textures, *info)
+	}
+	sort.Slice(report.Textures, func(i, j int) bool {
+		return report.Textures[i].Filename < report.Textures[j].Filename
+	})
+	sort.Slice(report.Images, func(i, j int) bool {
+		return report.Images[i].Name < report.Images[j].Name
+	})
+	return report
+}
+
+/*
+Stringは、読み込み済みの画像の一覧を表の形式で返します。
+*/
+func (report AssetReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "textures: %d bytes", report.Bytes)
+	if report.Budget > 0 {
+		fmt.Fprintf(&b, " / %d bytes", report.Budget)
+	}
+	b.WriteString("\n")
+	for _, t := range report.Textures {
+		fmt.Fprintf(&b, "  %s %dx%d %d bytes images:%d refs:%d sheets:%d\n", t.Filename, t.Width, t.Height, t.Bytes, t.Images, t.Refs, t.Sheets)
+	}
+	fmt.Fprintf(&b, "images: %d\n", len(report.Images))
+	for _, i := range report.Images {
+		state := "unloaded"
+		if i.Loaded {
+			state = "loaded"
+		}
+		fmt.Fprintf(&b, "  %s id:%d refs:%d %s\n", i.Name, i.ID, i.Refs, state)
+	}
+	return b.String()
+}
+
+/*
+loadTextureは、画像ファイルをテクスチャとして読み込みます。読み込み済みのファイルの場合はそのテクスチャを返します。
+呼び出す前にassets.mtxを取得しておく必要があります。
+*/
+func (renderer *Renderer) loadTexture(filename string) (*textureAsset, error) {
+	manager := renderer.assets
+	key := assetKey(filename)
+	if texture, ok := manager.textures[key]; ok {
+		return texture, nil
+	}
+	texture, err := renderer.readTexture(filename)
+	if err != nil {
+		return nil, err
+	}
+	manager.textures[key] = texture
+	manager.bytes += texture.bytes
+	manager.touch(texture)
+	return texture, nil
+}
+
+/*
+readTextureは、画像ファイルを読み込んでテクスチャと当たり判定用の画像を作成します。管理には加えません。
+*/
+func (renderer *Renderer) readTexture(filename string) (*textureAsset, error) {
+	surface, err := img.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer surface.Free()
+	mask, err := surfaceMask(surface)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := renderer.SdlRenderer.CreateTextureFromSurface(surface)
+	if err != nil {
+		return nil, err
+	}
+	return &textureAsset{
+		filename: assetKey(filename),
+		sheets:   make(map[data.ImageIdentifier]data.Rect),
+		texture:  tx,
+		mask:     mask,
+		width:    surface.W,
+		height:   surface.H,
+		bytes:    int64(surface.W) * int64(surface.H) * 4,
+	}, nil
+}
+
+/*
+unloadImageは、名前を付けたスプライト画像の登録を取り消し、使う画像が無くなったテクスチャを破棄します。
+呼び出す前にassets.mtxを取得しておく必要があります。
+*/
+func (renderer *Renderer) unloadImage(asset *imageAsset) {
+	manager := renderer.assets
+	texture, ok := manager.textures[asset.filename]
+	if si, found := renderer.SpriteImages[asset.id]; found && ok && si.SpriteTable == texture.texture {
+		renderer.markImageDirty(asset.id)
+		delete(renderer.SpriteImages, asset.id)
+		delete(renderer.masks, asset.id)
+	}
+	asset.loaded = false
+	asset.refs = 0
+	if ok {
+		renderer.releaseTexture(texture)
+	}
+}
+
+/*
+releaseTextureは、どのスプライト画像からも使われなくなったテクスチャを破棄します。
+*/
+func (renderer *Renderer) releaseTexture(texture *textureAsset) {
+	if len(texture.sheets) > 0 {
+		return
+	}
+	for _, asset := range renderer.assets.images {
+		if asset.loaded && asset.filename == texture.filename {
+			return
+		}
+	}
+	renderer.destroyTexture(texture)
+}
+
+// destroyTextureは、テクスチャを破棄して管理から外します
+func (renderer *Renderer) destroyTexture(texture *textureAsset) {
+	texture.texture.Destroy()
+	delete(renderer.assets.textures, texture.filename)
+	renderer.assets.bytes -= texture.bytes
+}
+
+/*
+enforceBudgetは、テクスチャの大きさの合計が上限を超えている場合に、破棄できるテクスチャを古いものから破棄します。
+呼び出す前にassets.mtxを取得しておく必要があります。
+*/
+func (renderer *Renderer) enforceBudget() {
+	manager := renderer.assets
+	if manager.budget <= 0 || manager.bytes <= manager.budget {
+		return
+	}
+	// スプライトが使っている画像は破棄しない
+	busy := busyTextures(manager.textures, manager.images, renderer.usedImages())
+	for _, texture := range evictionOrder(manager.textures, busy) {
+		if manager.bytes <= manager.budget {
+			break
+		}
+		for _, asset := range manager.images {
+			if asset.loaded && asset.filename == texture.filename {
+				renderer.unloadImage(asset)
+			}
+		}
+		// AddSpriteImagesで登録した画像は、スプライトが再び使う時に読み込み直せるようにしておく
+		for id, rect := range texture.sheets {
+			manager.evicted[id] = sheetImage{filename: texture.filename, rect: rect}
+			delete(renderer.SpriteImages, id)
+			delete(renderer.masks, id)
+		}
+		texture.sheets = nil
+		if _, ok := manager.textures[texture.filename]; ok {
+			renderer.destroyTexture(texture)
+		}
+	}
+}
+
+// usedImagesは、レイヤーのスプライトが使っているスプライト画像のIDを返します
+func (renderer *Renderer) usedImages() map[data.ImageIdentifier]bool {
+	used := make(map[data.ImageIdentifier]bool)
+	for _, layer := range renderer.Layers {
+		for _, sprite := range layer {
+			for _, id := range spriteImageIDs(sprite) {
+				used[id] = true
+			}
+		}
+	}
+	return used
+}
+
+// spriteImageIDsは、スプライトが書き出しに使うスプライト画像のIDを返します
+func spriteImageIDs(sprite *data.Sprite) []data.ImageIdentifier {
+	switch sprite.Kind {
+	case data.KindImage:
+		return []data.ImageIdentifier{sprite.SrcImageID}
+	case data.KindEmitter:
+		return sprite.Emitter.ImageIDs
+	}
+	return nil
+}
+
+/*
+busyTexturesは、破棄できないテクスチャのファイル名を返します。
+参照が残っているか、スプライトが使っている名前付きの画像、またはスプライトが使っているAddSpriteImagesの画像のファイルです。
+*/
+func busyTextures(
+	textures map[string]*textureAsset,
+	images map[string]*imageAsset,
+	used map[data.ImageIdentifier]bool,
+) map[string]bool {
+	busy := make(map[string]bool)
+	for _, asset := range images {
+		if asset.loaded && (asset.refs > 0 || used[asset.id]) {
+			busy[asset.filename] = true
+		}
+	}
+	for key, texture := range textures {
+		for id := range texture.sheets {
+			if used[id] {
+				busy[key] = true
+				break
+			}
+		}
+	}
+	return busy
+}
+
+/*
+evictionOrderは、破棄できるテクスチャを、使われていない期間が長い順に返します。
+busyに含まれるファイルのものは除きます。
+*/
+func evictionOrder(textures map[string]*textureAsset, busy map[string]bool) []*textureAsset {
+	var candidates []*textureAsset
+	for key, texture := range textures {
+		if !busy[key] {
+			candidates = append(candidates, texture)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].used < candidates[j].used
+	})
+	return candidates
+}
+
+/*
+restoreImagesは、スプライトが使うスプライト画像のうち、上限を超えたために破棄したAddSpriteImagesの画像を読み込み直します。
+読み込めなかった画像を使うスプライトは、書き出しの際にエラーとなります。
+*/
+func (renderer *Renderer) restoreImages(sprite *data.Sprite) {
+	manager := renderer.assets
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+	restored := false
+	for _, id := range spriteImageIDs(sprite) {
+		sheet, ok := manager.evicted[id]
+		if !ok {
+			continue
+		}
+		texture, err := renderer.loadTexture(sheet.filename)
+		if err != nil {
+			continue
+		}
+		delete(manager.evicted, id)
+		renderer.putSheetImage(texture, id, sheet.rect)
+		restored = true
+	}
+	if restored {
+		renderer.enforceBudget()
+	}
+}
+
+/*
+putSheetImageは、テクスチャの矩形をAddSpriteImagesのスプライト画像として登録します。
+同じIDを別のテクスチャに登録していた場合は、新しい矩形を登録してから元のテクスチャから外すため、
+同じファイルに登録し直してもテクスチャは破棄されません。
+呼び出す前にassets.mtxを取得しておく必要があります。
+*/
+func (renderer *Renderer) putSheetImage(texture *textureAsset, id data.ImageIdentifier, rect data.Rect) {
+	manager := renderer.assets
+	delete(manager.evicted, id)
+	old := manager.sheetTexture(id)
+	texture.sheets[id] = rect
+	if old != nil && old != texture {
+		delete(old.sheets, id)
+		renderer.releaseTexture(old)
+	}
+	manager.touch(texture)
+	renderer.SpriteImages[id] = &data.SpriteImage{SpriteTable: texture.texture, Rect: rect, Type: data.Resource}
+	renderer.masks[id] = texture.mask.sub(rect)
+	renderer.markImageDirty(id)
+}
+
+/*
+forgetSheetImageは、AddSpriteImagesで登録したスプライト画像をテクスチャから外します。
+外したテクスチャが他の画像から使われていなければ破棄します。
+呼び出す前にassets.mtxを取得しておく必要があります。
+*/
+func (renderer *Renderer) forgetSheetImage(id data.ImageIdentifier) {
+	manager := renderer.assets
+	delete(manager.evicted, id)
+	texture := manager.sheetTexture(id)
+	if texture == nil {
+		return
+	}
+	delete(texture.sheets, id)
+	if si, ok := renderer.SpriteImages[id]; ok && si.SpriteTable == texture.texture {
+		renderer.markImageDirty(id)
+		delete(renderer.SpriteImages, id)
+		delete(renderer.masks, id)
+	}
+	renderer.releaseTexture(texture)
+}
+
+// sheetTextureは、AddSpriteImagesで登録したスプライト画像のテクスチャを返します。登録が無ければnilです
+func (manager *assetManager) sheetTexture(id data.ImageIdentifier) *textureAsset {
+	for _, texture := range manager.textures {
+		if _, ok := texture.sheets[id]; ok {
+			return texture
+		}
+	}
+	return nil
+}
+
+/*
+RemoveSpriteImagesは、AddSpriteImagesで登録したスプライト画像の登録を取り消します。
+どのスプライト画像からも使われなくなったテクスチャは破棄します。
+取り消した画像を使うスプライトは書き出しの際にエラーとなるため、先に取り除いておく必要があります。
+*/
+func (renderer *Renderer) RemoveSpriteImages(identifiers []data.ImageIdentifier) {
+	renderer.assets.mtx.Lock()
+	defer renderer.assets.mtx.Unlock()
+	for _, id := range identifiers {
+		renderer.forgetSheetImage(id)
+	}
+}
@@ -0,0 +1,77 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestEvictionOrder(t *testing.T) {
+	textures := map[string]*textureAsset{
+		"a.png": {filename: "a.png", used: 3},
+		"b.png": {filename: "b.png", used: 1},
+		"c.png": {filename: "c.png", used: 2},
+		"d.png": {filename: "d.png", used: 0, sheets: map[data.ImageIdentifier]data.Rect{1: {}, 2: {}}},
+		"e.png": {filename: "e.png", used: 4, sheets: map[data.ImageIdentifier]data.Rect{3: {}}},
+	}
+	images := map[string]*imageAsset{
+		"c": {name: "c", id: firstAssetImageID, filename: "c.png", refs: 1, loaded: true},
+	}
+	// 参照されているものとスプライトが使っているものは破棄しない。AddSpriteImagesの画像も使われていなければ破棄する
+	busy := busyTextures(textures, images, map[data.ImageIdentifier]bool{2: true})
+	got := evictionOrder(textures, busy)
+	if len(got) != 3 || got[0].filename != "b.png" || got[1].filename != "a.png" || got[2].filename != "e.png" {
+		t.Errorf("unexpected order: %v", got)
+	}
+}
+
+func TestAlphaMaskSub(t *testing.T) {
+	// 4x2の画像で、右下の一点だけ不透明
+	pixels := make([]byte, 4*2*4)
+	pixels[(1*4+3)*4+3] = 255
+	mask := newAlphaMask(pixels, 16, data.Rect{Width: 4, Height: 2})
+	part := mask.sub(data.Rect{Left: 2, Top: 0, Width: 2, Height: 2})
+	if part.w != 2 || part.h != 2 {
+		t.Fatalf("unexpected size: %dx%d", part.w, part.h)
+	}
+	if !part.at(1, 1) || part.at(0, 1) || part.at(1, 0) {
+		t.Error("sub mask should keep the opaque pixel at its local position")
+	}
+}
+
+func TestPutSheetImageSameTexture(t *testing.T) {
+	renderer := &Renderer{}
+	renderer.initState()
+	manager := renderer.assets
+	sheet := func(name string) *textureAsset {
+		texture := &textureAsset{
+			filename: name,
+			mask:     newAlphaMask(make([]byte, 4*4*4), 16, data.Rect{Width: 4, Height: 4}),
+			sheets:   make(map[data.ImageIdentifier]data.Rect),
+		}
+		manager.textures[name] = texture
+		return texture
+	}
+	a := sheet("a.png")
+	renderer.putSheetImage(a, 1, data.Rect{Width: 2, Height: 2})
+	// 同じファイルに登録し直しても、テクスチャは破棄せず矩形だけを変える
+	renderer.putSheetImage(a, 1, data.Rect{Left: 2, Width: 2, Height: 2})
+	if manager.textures["a.png"] != a || manager.sheetTexture(1) != a {
+		t.Fatalf("texture released on re-register: %v", manager.textures)
+	}
+	if renderer.SpriteImages[1].Rect.Left != 2 {
+		t.Errorf("sprite image: %+v", renderer.SpriteImages[1])
+	}
+	// 別のファイルに登録し直した場合は、新しいテクスチャに登録してから元のテクスチャを解放する
+	b := sheet("b.png")
+	renderer.putSheetImage(b, 1, data.Rect{Width: 2, Height: 2})
+	if manager.sheetTexture(1) != b || b.sheets[1] != (data.Rect{Width: 2, Height: 2}) {
+		t.Errorf("sheets: a %v b %v", a.sheets, b.sheets)
+	}
+	if _, ok := manager.textures["a.png"]; ok {
+		t.Errorf("unused texture should be released")
+	}
+	if _, ok := manager.textures["b.png"]; !ok {
+		t.Errorf("new texture should be kept")
+	}
+}
@@ -0,0 +1,126 @@
+package pilot
+
+import (
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// 同じテクスチャのまとまりを探すために遡るまとまりの数の上限
+	maxBatchLookback = 16
+	// 範囲を決められないため、後のスプライトを前に移せないスプライトのテクスチャの番号
+	batchBarrier = -1
+)
+
+/*
+drawBatchは、同じテクスチャを使い、続けて書き出すスプライトのまとまりです。
+*/
+type drawBatch struct {
+	key     int      // テクスチャの番号（batchBarrierなら文字列・粒子）
+	bounds  sdl.Rect // まとまりのスプライト全体を囲む矩形
+	sprites []*data.Sprite
+}
+
+/*
+batchSpritesは、書き出す順に並べたスプライトを、同じテクスチャを使うまとまりに分けます。
+keysはスプライトごとのテクスチャの番号です。Priorityが同じスプライトが続く範囲の中でだけ並べ替え、
+スプライトは、間にあるまとまりのどれとも重ならない場合に限り、前にある同じテクスチャのまとまりに加えます。
+そのため、重なり合うスプライトの前後関係は元の順のままになります。
+*/
+func batchSprites(sprites []*data.Sprite, keys []int) []drawBatch {
+	var batches []drawBatch
+	bandStart := 0
+	for i, sprite := range sprites {
+		if i > 0 && sprite.Priority != sprites[i-1].Priority {
+			bandStart = len(batches)
+		}
+		key := keys[i]
+		if key == batchBarrier {
+			batches = append(batches, drawBatch{key: key, sprites: []*data.Sprite{sprite}})
+			continue
+		}
+		bounds := spriteBounds(sprite)
+		placed := false
+		limit := len(batches) - maxBatchLookback
+		if limit < bandStart {
+			limit = bandStart
+		}
+		for j := len(batches) - 1; j >= limit; j-- {
+			batch := &batches[j]
+			if batch.key == key {
+				batch.sprites = append(batch.sprites, sprite)
+				batch.bounds = batch.bounds.Union(&bounds)
+				placed = true
+				break
+			}
+			if batch.key == batchBarrier || batch.bounds.HasIntersection(&bounds) {
+				break
+			}
+		}
+		if !placed {
+			batches = append(batches, drawBatch{key: key, bounds: bounds, sprites: []*data.Sprite{sprite}})
+		}
+	}
+	return batches
+}
+
+/*
+drawBatchedは、スプライトを同じテクスチャのまとまりごとに書き出します。
+*/
+func (renderer *Renderer) drawBatched(sprites []*data.Sprite) error {
+	keys := make([]int, len(sprites))
+	textures := make(map[*sdl.Texture]int)
+	for i, sprite := range sprites {
+		texture, ok := renderer.spriteTexture(sprite)
+		if !ok {
+			keys[i] = batchBarrier
+			continue
+		}
+		key, ok := textures[texture]
+		if !ok {
+			key = len(textures)
+			textures[texture] = key
+		}
+		keys[i] = key
+	}
+	batches := batchSprites(sprites, keys)
+	renderer.frameDraw.Batches += len(batches)
+	for _, batch := range batches {
+		for _, sprite := range batch.sprites {
+			if err := renderer.drawSprite(sprite); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+spriteTextureは、スプライトの書き出しに使うテクスチャを返します。図形はテクスチャを使わないためnilです。
+文字列と粒子は書き出される範囲を決められないため、まとめる対象にしません。
+*/
+func (renderer *Renderer) spriteTexture(sprite *data.Sprite) (*sdl.Texture, bool) {
+	switch sprite.Kind {
+	case data.KindText, data.KindEmitter:
+		return nil, false
+	case data.KindShape:
+		return nil, true
+	}
+	si, ok := renderer.SpriteImages[sprite.SrcImageID]
+	if !ok {
+		return nil, false
+	}
+	return si.SpriteTable, true
+}
+
+/*
+countDrawは、書き出しの命令の数と、直前の書き出しからテクスチャが切り替わった数を数えます。
+テクスチャを使わない書き出しはnilを渡します。
+*/
+func (renderer *Renderer) countDraw(texture *sdl.Texture) {
+	renderer.frameDraw.DrawCalls++
+	if texture != renderer.lastTexture {
+		renderer.frameDraw.TextureSwitches++
+		renderer.lastTexture = texture
+	}
+}
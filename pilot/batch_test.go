@@ -0,0 +1,40 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestBatchSprites(t *testing.T) {
+	at := func(x int32, priority int32) *data.Sprite {
+		return &data.Sprite{
+			DistRect: data.Rect{Left: x, Top: 0, Width: 10, Height: 10},
+			ScaleX:   1,
+			ScaleY:   1,
+			Priority: priority,
+		}
+	}
+	// 重ならないスプライトは同じテクスチャのまとまりに移す
+	a, b, c := at(0, 0), at(100, 0), at(200, 0)
+	batches := batchSprites([]*data.Sprite{a, b, c}, []int{0, 1, 0})
+	if len(batches) != 2 || len(batches[0].sprites) != 2 || batches[0].sprites[1] != c {
+		t.Errorf("non-overlapping: %+v", batches)
+	}
+	// 間のスプライトと重なる場合は前後関係を保つ
+	d := at(105, 0)
+	batches = batchSprites([]*data.Sprite{a, b, d}, []int{0, 1, 0})
+	if len(batches) != 3 {
+		t.Errorf("overlapping: %d batches", len(batches))
+	}
+	// Priorityが変わる所と、文字列・粒子は越えない
+	e := at(300, 1)
+	batches = batchSprites([]*data.Sprite{a, b, e}, []int{0, 1, 0})
+	if len(batches) != 3 {
+		t.Errorf("priority band: %d batches", len(batches))
+	}
+	batches = batchSprites([]*data.Sprite{a, b, c}, []int{0, batchBarrier, 0})
+	if len(batches) != 3 {
+		t.Errorf("barrier: %d batches", len(batches))
+	}
+}
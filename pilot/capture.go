@@ -0,0 +1,270 @@
+package pilot
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// 記録する間隔の初期値（ミリ秒）
+const defaultCaptureInterval = 40
+
+// アニメーションGIFに記録する画面の数の上限（全ての画面をメモリに保持してから書き出すため）
+const maxGIFFrames = 750
+
+/*
+captureJobは、画面の保存の一件分の状態です。
+画像の読み取りは画面描画のスレッドで行い、ファイルへの書き出しは別のgoroutineで行います。
+*/
+type captureJob struct {
+	capture data.Capture
+	frames  chan *image.RGBA // 書き出しを行うgoroutineへ渡す画面
+	done    chan error       // 書き出しの結果
+	elapsed uint32           // 記録を開始してからの経過時間（ミリ秒）
+	next    uint32           // 次に記録する時刻（ミリ秒）
+	count   int              // 書き出し用のgoroutineへ渡した画面の数
+	closed  bool             // 記録を終えたか否か
+}
+
+/*
+StartCaptureは、画面の保存を開始します。
+CapturePNGの場合は次に書き出す画面を一枚保存し、それ以外の場合はDurationの間の画面を記録します。
+記録中に別の記録を開始した場合は、記録中のものを打ち切ってファイルに書き出します。
+CaptureGIFの場合は、maxGIFFrames枚を記録した時点で打ち切ります。
+*/
+func (renderer *Renderer) StartCapture(capture data.Capture) {
+	if capture.Interval == 0 {
+		capture.Interval = defaultCaptureInterval
+	}
+	if capture.Format != data.CapturePNG {
+		renderer.StopCapture()
+	}
+	job := captureJob{
+		capture: capture,
+		frames:  make(chan *image.RGBA, 8),
+		done:    make(chan error, 1),
+	}
+	go job.write()
+	renderer.captures = append(renderer.captures, &job)
+}
+
+/*
+StopCaptureは、記録中の画面の保存を打ち切り、それまでの画面をファイルに書き出します。
+次に書き出す画面を待っているCapturePNGの保存は打ち切りません。
+*/
+func (renderer *Renderer) StopCapture() {
+	for _, job := range renderer.captures {
+		if job.capture.Format != data.CapturePNG {
+			job.close()
+		}
+	}
+}
+
+/*
+SaveScreenshotは、次に書き出す画面をPNGに保存します。
+*/
+func (renderer *Renderer) SaveScreenshot(filename string) {
+	renderer.StartCapture(data.Capture{Filename: filename, Format: data.CapturePNG})
+}
+
+/*
+CaptureDroppedは、書き出しが追いつかず記録しなかった画面の数の累計を返します。
+別のgoroutineから呼び出すことができます。
+*/
+func (renderer *Renderer) CaptureDropped() int {
+	renderer.mtxStats.Lock()
+	defer renderer.mtxStats.Unlock()
+	return renderer.captureDropped
+}
+
+/*
+ReadScreenは、直前に書き出した論理解像度の画面を画像として読み取ります。
+画面描画と同じスレッドから呼び出す必要があります。
+*/
+func (renderer *Renderer) ReadScreen() (*image.RGBA, error) {
+	if err := renderer.SdlRenderer.SetRenderTarget(renderer.screen); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, int(renderer.logicalW), int(renderer.logicalH)))
+	err := renderer.SdlRenderer.ReadPixels(
+		nil,
+		uint32(sdl.PIXELFORMAT_RGBA32),
+		unsafe.Pointer(&img.Pix[0]),
+		img.Stride,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+/*
+captureScreenは、保存や記録を行っている場合に画面を読み取って書き出し用のgoroutineへ渡します。
+DrawLayersで画面を重ね終えた後に呼び出されます。
+書き出しが追いつかない場合は画面描画を止めずにその画面を記録せず、数を数えます。
+CapturePNGの場合は次に書き出す画面で保存し直します。
+*/
+func (renderer *Renderer) captureScreen() error {
+	for _, job := range renderer.captures {
+		if job.closed || job.elapsed < job.next {
+			continue
+		}
+		img, err := renderer.ReadScreen()
+		if err != nil {
+			return err
+		}
+		renderer.sendFrame(job, img)
+	}
+	return nil
+}
+
+/*
+sendFrameは、読み取った画面を書き出し用のgoroutineへ渡し、次に記録する時刻を進めます。
+*/
+func (renderer *Renderer) sendFrame(job *captureJob, img *image.RGBA) {
+	select {
+	case job.frames <- img:
+		job.count++
+	default:
+		renderer.mtxStats.Lock()
+		renderer.captureDropped++
+		renderer.mtxStats.Unlock()
+		if job.capture.Format == data.CapturePNG {
+			return
+		}
+	}
+	job.next += job.capture.Interval
+	switch job.capture.Format {
+	case data.CapturePNG:
+		job.close()
+	case data.CaptureGIF:
+		if job.count >= maxGIFFrames {
+			job.close()
+		}
+	}
+}
+
+/*
+updateCapturesは、記録の経過時間を進め、書き出しを終えた保存の結果をイベントとして送信待ちにします。
+*/
+func (renderer *Renderer) updateCaptures(delta uint32) {
+	running := renderer.captures[:0]
+	for _, job := range renderer.captures {
+		job.elapsed += delta
+		if job.capture.Format != data.CapturePNG && job.elapsed >= job.capture.Duration {
+			job.close()
+		}
+		select {
+		case err := <-job.done:
+			code := data.CaptureEnd
+			if err != nil {
+				code = data.CaptureFailed
+			}
+			renderer.pushEvent(data.Event{Device: data.DeviceRenderer, Code: code})
+		default:
+			running = append(running, job)
+		}
+	}
+	renderer.captures = running
+}
+
+/*
+closeは、記録を終えて書き出し用のgoroutineに残りの書き出しを行わせます。
+*/
+func (job *captureJob) close() {
+	if !job.closed {
+		job.closed = true
+		close(job.frames)
+	}
+}
+
+/*
+writeは、受け取った画面をファイルに書き出します。別のgoroutineで実行されます。
+*/
+func (job *captureJob) write() {
+	var err error
+	switch job.capture.Format {
+	case data.CapturePNG:
+		for img := range job.frames {
+			err = writePNG(job.capture.Filename, img)
+		}
+	case data.CapturePNGSequence:
+		i := 0
+		for img := range job.frames {
+			if err == nil {
+				err = writePNG(sequenceName(job.capture.Filename, i), img)
+			}
+			i++
+		}
+	case data.CaptureGIF:
+		err = job.writeGIF()
+	}
+	job.done <- err
+}
+
+/*
+writeGIFは、受け取った画面を256色に減色してアニメーションGIFに書き出します。
+*/
+func (job *captureJob) writeGIF() error {
+	anim := gif.GIF{}
+	delay := int(job.capture.Interval+5) / 10 // 100分の1秒単位
+	for img := range job.frames {
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.Draw(frame, frame.Rect, img, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	if len(anim.Image) == 0 {
+		return nil
+	}
+	file, err := os.Create(job.capture.Filename)
+	if err != nil {
+		return err
+	}
+	if err = gif.EncodeAll(file, &anim); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writePNGは、画像をPNGファイルに書き出します
+func writePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/*
+sequenceNameは、連番のファイル名を返します。
+書式を含まないファイル名の場合は、拡張子の前に4桁の番号を付けます。
+*/
+func sequenceName(pattern string, i int) string {
+	if strings.Contains(pattern, "%") {
+		return fmt.Sprintf(pattern, i)
+	}
+	ext := filepath.Ext(pattern)
+	return fmt.Sprintf("%s%04d%s", strings.TrimSuffix(pattern, ext), i, ext)
+}
+
+// screenshotNameは、ホットキーで保存する画面のファイル名を返します
+func screenshotName(dir string, now time.Time) string {
+	return filepath.Join(dir, now.Format("screenshot-20060102-150405.000.png"))
+}
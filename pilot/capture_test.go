@@ -0,0 +1,123 @@
+package pilot
+
+import (
+	"image"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestStartCaptureKeepsScreenshot(t *testing.T) {
+	dir := t.TempDir()
+	renderer := &Renderer{}
+	renderer.SaveScreenshot(filepath.Join(dir, "shot.png"))
+	// 記録を開始しても、次の画面を待っているPNGの保存は打ち切らない
+	renderer.StartCapture(data.Capture{Filename: filepath.Join(dir, "a.gif"), Format: data.CaptureGIF, Duration: 1000})
+	renderer.StartCapture(data.Capture{Filename: filepath.Join(dir, "b.gif"), Format: data.CaptureGIF, Duration: 1000})
+	if len(renderer.captures) != 3 {
+		t.Fatalf("captures: %d", len(renderer.captures))
+	}
+	shot, first, second := renderer.captures[0], renderer.captures[1], renderer.captures[2]
+	if shot.closed || !first.closed || second.closed {
+		t.Errorf("closed: shot %v first %v second %v", shot.closed, first.closed, second.closed)
+	}
+	renderer.StopCapture()
+	if shot.closed || !second.closed {
+		t.Errorf("stop: shot %v second %v", shot.closed, second.closed)
+	}
+	shot.close()
+	for _, job := range renderer.captures {
+		if err := <-job.done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSendFrame(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	newJob := func(format data.CaptureFormat, buffer int) *captureJob {
+		return &captureJob{
+			capture: data.Capture{Format: format, Interval: 40},
+			frames:  make(chan *image.RGBA, buffer),
+		}
+	}
+	renderer := &Renderer{}
+	// 書き出しが追いつかないPNGの保存は、数を数えて次の画面で保存し直す
+	job := newJob(data.CapturePNG, 0)
+	renderer.sendFrame(job, img)
+	if job.closed || job.next != 0 || renderer.CaptureDropped() != 1 {
+		t.Errorf("png dropped: closed %v next %d dropped %d", job.closed, job.next, renderer.CaptureDropped())
+	}
+	job = newJob(data.CapturePNG, 1)
+	renderer.sendFrame(job, img)
+	if !job.closed || job.count != 1 {
+		t.Errorf("png sent: closed %v count %d", job.closed, job.count)
+	}
+	// 記録では、書き出しが追いつかない画面を飛ばして次の時刻へ進む
+	job = newJob(data.CapturePNGSequence, 0)
+	renderer.sendFrame(job, img)
+	if job.closed || job.next != 40 || renderer.CaptureDropped() != 2 {
+		t.Errorf("sequence dropped: closed %v next %d dropped %d", job.closed, job.next, renderer.CaptureDropped())
+	}
+	// アニメーションGIFは上限の枚数で打ち切る
+	job = newJob(data.CaptureGIF, maxGIFFrames)
+	for i := 0; i < maxGIFFrames-1; i++ {
+		renderer.sendFrame(job, img)
+	}
+	if job.closed {
+		t.Fatal("gif closed before the frame limit")
+	}
+	renderer.sendFrame(job, img)
+	if !job.closed || job.count != maxGIFFrames {
+		t.Errorf("gif limit: closed %v count %d", job.closed, job.count)
+	}
+}
+
+func TestWriteGIF(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "anim.gif")
+	job := &captureJob{
+		capture: data.Capture{Filename: filename, Format: data.CaptureGIF, Interval: 40},
+		frames:  make(chan *image.RGBA, 3),
+		done:    make(chan error, 1),
+	}
+	for i := 0; i < 3; i++ {
+		job.frames <- image.NewRGBA(image.Rect(0, 0, 4, 4))
+	}
+	job.close()
+	job.write()
+	if err := <-job.done; err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	anim, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 || anim.Delay[0] != 4 {
+		t.Errorf("frames %d delay %v", len(anim.Image), anim.Delay)
+	}
+}
+
+func TestSequenceName(t *testing.T) {
+	cases := []struct {
+		pattern string
+		i       int
+		want    string
+	}{
+		{"frame%03d.png", 7, "frame007.png"},
+		{"shots/frame.png", 12, "shots/frame0012.png"},
+		{"frame", 3, "frame0003"},
+	}
+	for _, c := range cases {
+		if got := sequenceName(c.pattern, c.i); got != c.want {
+			t.Errorf("%q %d: want %q, got %q", c.pattern, c.i, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package pilot
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// 広域判定に使う空間ハッシュの一マスの大きさ（論理解像度のピクセル）
+	collisionCellSize = 64
+	// 画像の不透明な部分とみなす不透明度
+	maskAlphaThreshold = 128
+)
+
+/*
+alphaMaskは、スプライト画像の不透明な部分を表す当たり判定用の画像です。
+*/
+type alphaMask struct {
+	w, h   int32
+	opaque []bool
+}
+
+/*
+newAlphaMaskは、RGBA32形式の画素から、矩形rectの範囲の当たり判定用の画像を作成します。
+*/
+func newAlphaMask(pixels []byte, pitch int, rect data.Rect) *alphaMask {
+	mask := alphaMask{w: rect.Width, h: rect.Height, opaque: make([]bool, rect.Width*rect.Height)}
+	for y := int32(0); y < rect.Height; y++ {
+		for x := int32(0); x < rect.Width; x++ {
+			i := int(rect.Top+y)*pitch + int(rect.Left+x)*4 + 3
+			if i < len(pixels) {
+				mask.opaque[y*rect.Width+x] = pixels[i] >= maskAlphaThreshold
+			}
+		}
+	}
+	return &mask
+}
+
+// atは、画像上の座標が不透明か否かを返します
+func (mask *alphaMask) at(x, y int32) bool {
+	if x < 0 || y < 0 || x >= mask.w || y >= mask.h {
+		return false
+	}
+	return mask.opaque[y*mask.w+x]
+}
+
+/*
+surfaceMaskは、読み込んだ画像全体の当たり判定用の画像を作成します。
+*/
+func surfaceMask(surface *sdl.Surface) (*alphaMask, error) {
+	rgba, err := surface.ConvertFormat(uint32(sdl.PIXELFORMAT_RGBA32), 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rgba.Free()
+	if err = rgba.Lock(); err != nil {
+		return nil, err
+	}
+	defer rgba.Unlock()
+	return newAlphaMask(rgba.Pixels(), int(rgba.Pitch), data.Rect{Width: rgba.W, Height: rgba.H}), nil
+}
+
+// subは、矩形rectの範囲を切り出した当たり判定用の画像を返します
+func (mask *alphaMask) sub(rect data.Rect) *alphaMask {
+	part := alphaMask{w: rect.Width, h: rect.Height, opaque: make([]bool, rect.Width*rect.Height)}
+	for y := int32(0); y < rect.Height; y++ {
+		for x := int32(0); x < rect.Width; x++ {
+			part.opaque[y*rect.Width+x] = mask.at(rect.Left+x, rect.Top+y)
+		}
+	}
+	return &part
+}
+
+/*
+collisionBodyは、当たり判定を行うために論理解像度の座標に変換したスプライトの形です。
+*/
+type collisionBody struct {
+	sprite  *data.Sprite
+	shape   data.ColliderShape
+	bounds  [4]float64 // 囲む矩形（左, 上, 右, 下）
+	corners []fpoint   // 矩形の四隅（ColliderBox, ColliderOriented, ColliderPixel）
+	cx, cy  float64    // 円の中心（ColliderCircle）
+	r       float64    // 円の半径（ColliderCircle）
+	mask    *alphaMask // 当たり判定用の画像（ColliderPixel）
+}
+
+// collisionPairは、接触している二つのスプライトです（Aの方がIDが小さい）
+type collisionPair struct {
+	a, b data.SpriteIdentifier
+}
+
+/*
+newCollisionBodyは、スプライトの当たり判定の形を求めます。
+*/
+func (renderer *Renderer) newCollisionBody(sprite *data.Sprite) *collisionBody {
+	body := collisionBody{sprite: sprite, shape: sprite.Collider.Shape}
+	w, h := float64(sprite.DistRect.Width), float64(sprite.DistRect.Height)
+	switch body.shape {
+	case data.ColliderBox:
+		// 回転を無視して拡大のみ反映する
+		dist, _ := spriteDist(sprite)
+		x0, y0 := float64(dist.X), float64(dist.Y)
+		x1, y1 := x0+float64(dist.W), y0+float64(dist.H)
+		body.corners = []fpoint{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+	case data.ColliderCircle:
+		c := transformPoint(sprite, fpoint{w / 2, h / 2})
+		body.cx, body.cy = c.x, c.y
+		body.r = float64(sprite.Collider.Radius) * math.Max(math.Abs(sprite.ScaleX), math.Abs(sprite.ScaleY))
+		if sprite.Collider.Radius <= 0 {
+			body.r = math.Min(w*math.Abs(sprite.ScaleX), h*math.Abs(sprite.ScaleY)) / 2
+		}
+		body.bounds = [4]float64{c.x - body.r, c.y - body.r, c.x + body.r, c.y + body.r}
+		return &body
+	default:
+		body.corners = []fpoint{
+			transformPoint(sprite, fpoint{0, 0}),
+			transformPoint(sprite, fpoint{w, 0}),
+			transformPoint(sprite, fpoint{w, h}),
+			transformPoint(sprite, fpoint{0, h}),
+		}
+		if body.shape == data.ColliderPixel {
+			body.mask = renderer.masks[sprite.SrcImageID]
+		}
+	}
+	body.bounds = [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range body.corners {
+		body.bounds[0] = math.Min(body.bounds[0], p.x)
+		body.bounds[1] = math.Min(body.bounds[1], p.y)
+		body.bounds[2] = math.Max(body.bounds[2], p.x)
+		body.bounds[3] = math.Max(body.bounds[3], p.y)
+	}
+	return &body
+}
+
+/*
+updateCollisionsは、当たり判定を持つスプライトの接触を調べ、接触の開始・終了をイベントとして送信待ちにします。
+接触の継続は、どちらかのスプライトがCollider.Stayを指定した組だけ送ります。
+広域判定として空間ハッシュで近くにあるスプライトの組だけを選び、詳細な判定を行います。
+*/
+func (renderer *Renderer) updateCollisions() {
+	grid := make(map[[2]int32][]*collisionBody)
+	for _, layer := range renderer.Layers {
+		for _, sprite := range layer {
+			if sprite.Collider.Shape == data.ColliderNone {
+				continue
+			}
+			body := renderer.newCollisionBody(sprite)
+			x0, y0 := cellIndex(body.bounds[0]), cellIndex(body.bounds[1])
+			x1, y1 := cellIndex(body.bounds[2]), cellIndex(body.bounds[3])
+			for y := y0; y <= y1; y++ {
+				for x := x0; x <= x1; x++ {
+					grid[[2]int32{x, y}] = append(grid[[2]int32{x, y}], body)
+				}
+			}
+		}
+	}
+	tested := make(map[collisionPair]bool)
+	contacts := make(map[collisionPair]bool)
+	for _, cell := range grid {
+		for i := 0; i < len(cell); i++ {
+			for j := i + 1; j < len(cell); j++ {
+				pair := newCollisionPair(cell[i].sprite.Id, cell[j].sprite.Id)
+				if tested[pair] {
+					continue
+				}
+				tested[pair] = true
+				if canCollide(cell[i].sprite, cell[j].sprite) && bodiesCollide(cell[i], cell[j]) {
+					contacts[pair] = cell[i].sprite.Collider.Stay || cell[j].sprite.Collider.Stay
+				}
+			}
+		}
+	}
+	for pair, stay := range contacts {
+		if _, ok := renderer.contacts[pair]; !ok {
+			renderer.pushCollisionEvent(data.CollisionEnter, pair)
+		} else if stay {
+			renderer.pushCollisionEvent(data.CollisionStay, pair)
+		}
+	}
+	for pair := range renderer.contacts {
+		if _, ok := contacts[pair]; !ok {
+			renderer.pushCollisionEvent(data.CollisionExit, pair)
+		}
+	}
+	renderer.contacts = contacts
+}
+
+/*
+Collidesは、二つのスプライトが接触しているか否かを直ちに調べます。
+衝突レイヤーの設定は考慮しません。画面描画と同じスレッドから呼び出す必要があります。
+*/
+func (renderer *Renderer) Collides(a, b data.SpriteIdentifier) bool {
+	sa, ok := renderer.findSprite(a)
+	if !ok || sa.Collider.Shape == data.ColliderNone {
+		return false
+	}
+	sb, ok := renderer.findSprite(b)
+	if !ok || sb.Collider.Shape == data.ColliderNone {
+		return false
+	}
+	return bodiesCollide(renderer.newCollisionBody(sa), renderer.newCollisionBody(sb))
+}
+
+// pushCollisionEventは、接触のイベントを送信待ちにします
+func (renderer *Renderer) pushCollisionEvent(code data.EventCode, pair collisionPair) {
+	renderer.pushEvent(data.Event{
+		Device:    data.DeviceRenderer,
+		Code:      code,
+		Collision: data.Collision{A: pair.a, B: pair.b},
+	})
+}
+
+// newCollisionPairは、IDの順に並べた組を返します
+func newCollisionPair(a, b data.SpriteIdentifier) collisionPair {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return collisionPair{a: a, b: b}
+}
+
+// cellIndexは、座標を空間ハッシュのマスの番号に変換します
+func cellIndex(v float64) int32 {
+	return int32(math.Floor(v / collisionCellSize))
+}
+
+// canCollideは、衝突レイヤーの設定から二つのスプライトを判定するか否かを返します
+func canCollide(a, b *data.Sprite) bool {
+	return a.Collider.Mask&b.Collider.Layer != 0 && b.Collider.Mask&a.Collider.Layer != 0
+}
+
+/*
+bodiesCollideは、二つの当たり判定の形が重なっているか否かを返します。
+*/
+func bodiesCollide(a, b *collisionBody) bool {
+	if a.bounds[0] >= b.bounds[2] || b.bounds[0] >= a.bounds[2] ||
+		a.bounds[1] >= b.bounds[3] || b.bounds[1] >= a.bounds[3] {
+		return false
+	}
+	if a.shape == data.ColliderPixel || b.shape == data.ColliderPixel {
+		return rasterCollide(a, b)
+	}
+	switch {
+	case a.shape == data.ColliderCircle && b.shape == data.ColliderCircle:
+		return math.Hypot(a.cx-b.cx, a.cy-b.cy) < a.r+b.r
+	case a.shape == data.ColliderCircle:
+		return polygonCircleOverlap(b.corners, a.cx, a.cy, a.r)
+	case b.shape == data.ColliderCircle:
+		return polygonCircleOverlap(a.corners, b.cx, b.cy, b.r)
+	}
+	return polygonsOverlap(a.corners, b.corners)
+}
+
+/*
+polygonsOverlapは、分離軸定理により二つの凸多角形が重なっているか否かを返します。
+*/
+func polygonsOverlap(a, b []fpoint) bool {
+	for _, poly := range [][]fpoint{a, b} {
+		for i := range poly {
+			p, q := poly[i], poly[(i+1)%len(poly)]
+			// 辺の法線を軸にする
+			nx, ny := q.y-p.y, p.x-q.x
+			minA, maxA := projectPolygon(a, nx, ny)
+			minB, maxB := projectPolygon(b, nx, ny)
+			if maxA <= minB || maxB <= minA {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// projectPolygonは、多角形を軸に投影した範囲を返します
+func projectPolygon(poly []fpoint, nx, ny float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range poly {
+		d := p.x*nx + p.y*ny
+		lo, hi = math.Min(lo, d), math.Max(hi, d)
+	}
+	return lo, hi
+}
+
+/*
+polygonCircleOverlapは、凸多角形と円が重なっているか否かを返します。
+*/
+func polygonCircleOverlap(poly []fpoint, cx, cy, r float64) bool {
+	if polygonContains(poly, cx, cy) {
+		return true
+	}
+	for i := range poly {
+		p, q := poly[i], poly[(i+1)%len(poly)]
+		if segmentDistance(p, q, cx, cy) < r {
+			return true
+		}
+	}
+	return false
+}
+
+// polygonContainsは、点が凸多角形の内側にあるか否かを返します
+func polygonContains(poly []fpoint, x, y float64) bool {
+	sign := 0.0
+	for i := range poly {
+		p, q := poly[i], poly[(i+1)%len(poly)]
+		cross := (q.x-p.x)*(y-p.y) - (q.y-p.y)*(x-p.x)
+		if cross == 0 {
+			continue
+		}
+		if sign == 0 {
+			sign = cross
+		} else if (sign > 0) != (cross > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentDistanceは、点と線分の距離を返します
+func segmentDistance(p, q fpoint, x, y float64) float64 {
+	dx, dy := q.x-p.x, q.y-p.y
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = clamp01(((x-p.x)*dx + (y-p.y)*dy) / l)
+	}
+	return math.Hypot(p.x+dx*t-x, p.y+dy*t-y)
+}
+
+/*
+rasterCollideは、二つの形が重なる範囲のピクセルを一つずつ調べて重なっているか否かを返します。
+画像の不透明な部分による判定に使います。
+*/
+func rasterCollide(a, b *collisionBody) bool {
+	x0 := math.Floor(math.Max(a.bounds[0], b.bounds[0]))
+	y0 := math.Floor(math.Max(a.bounds[1], b.bounds[1]))
+	x1 := math.Ceil(math.Min(a.bounds[2], b.bounds[2]))
+	y1 := math.Ceil(math.Min(a.bounds[3], b.bounds[3]))
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			// ピクセルの中心で判定する
+			if a.contains(x+0.5, y+0.5) && b.contains(x+0.5, y+0.5) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+containsは、論理解像度の座標が当たり判定の形の内側にあるか否かを返します。
+*/
+func (body *collisionBody) contains(x, y float64) bool {
+	switch body.shape {
+	case data.ColliderCircle:
+		return math.Hypot(x-body.cx, y-body.cy) < body.r
+	case data.ColliderPixel:
+		sprite := body.sprite
+		lx, ly, ok := spriteLocalPoint(sprite, x, y)
+		if !ok || lx < 0 || ly < 0 || lx >= float64(sprite.DistRect.Width) || ly >= float64(sprite.DistRect.Height) {
+			return false
+		}
+		if body.mask == nil {
+			// 画像がない場合は矩形として扱う
+			return true
+		}
+		// DistRectの座標をスプライト画像の座標に変換する
+		mx := int32(lx * float64(body.mask.w) / float64(sprite.DistRect.Width))
+		my := int32(ly * float64(body.mask.h) / float64(sprite.DistRect.Height))
+		return body.mask.at(mx, my)
+	}
+	return polygonContains(body.corners, x, y)
+}
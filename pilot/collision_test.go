@@ -0,0 +1,61 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+// squareは、中心と半分の幅、回転角度（度）から四隅を求めます
+func square(cx, cy, half, angle float64) []fpoint {
+	sprite := data.NewSprite(0)
+	size := int32(half * 2)
+	sprite.DistRect = data.Rect{Left: int32(cx - half), Top: int32(cy - half), Width: size, Height: size}
+	sprite.Rotate = data.Rotate{CenterX: size / 2, CenterY: size / 2, Angle: angle}
+	w := float64(size)
+	return []fpoint{
+		transformPoint(&sprite, fpoint{0, 0}),
+		transformPoint(&sprite, fpoint{w, 0}),
+		transformPoint(&sprite, fpoint{w, w}),
+		transformPoint(&sprite, fpoint{0, w}),
+	}
+}
+
+func TestPolygonsOverlap(t *testing.T) {
+	a := square(0, 0, 10, 0)
+	// 軸に揃った矩形では離れているが、45度回転すると角が届く
+	if polygonsOverlap(a, square(23, 0, 10, 0)) {
+		t.Error("separated boxes should not overlap")
+	}
+	if !polygonsOverlap(a, square(23, 0, 10, 45)) {
+		t.Error("rotated box should reach")
+	}
+	// 囲む矩形は重なるが、回転した矩形の辺の間に隙間がある
+	if polygonsOverlap(square(0, 0, 10, 45), square(20, 20, 10, 45)) {
+		t.Error("diagonal neighbours should not overlap")
+	}
+}
+
+func TestPolygonCircleOverlap(t *testing.T) {
+	box := square(0, 0, 10, 0)
+	if !polygonCircleOverlap(box, 14, 0, 5) {
+		t.Error("circle touching the edge should overlap")
+	}
+	if polygonCircleOverlap(box, 14, 14, 5) {
+		t.Error("circle near the corner should not overlap")
+	}
+}
+
+func TestAlphaMask(t *testing.T) {
+	// 4x2の画像の右半分が不透明
+	pixels := make([]byte, 4*2*4)
+	for y := 0; y < 2; y++ {
+		for x := 2; x < 4; x++ {
+			pixels[(y*4+x)*4+3] = 255
+		}
+	}
+	mask := newAlphaMask(pixels, 16, data.Rect{Left: 1, Top: 0, Width: 2, Height: 2})
+	if mask.at(0, 0) || !mask.at(1, 1) || mask.at(2, 0) {
+		t.Errorf("mask: %+v", mask.opaque)
+	}
+}
@@ -0,0 +1,156 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// 空間インデックスの一マスの大きさ（論理解像度のピクセル）
+	cullCellSize = 128
+	// 一つのスプライトを登録するマスの上限（超える大きなスプライトは常に書き出す候補にする）
+	maxCullCells = 256
+)
+
+/*
+DrawStatsは、直前のフレームで書き直したレイヤーのスプライトの集計です。
+*/
+type DrawStats struct {
+	Layers          int // 書き直したレイヤーの数
+	Drawn           int // 書き出したスプライトの数
+	Culled          int // 画面外や書き直す範囲外のため、書き出さなかったスプライトの数
+	Batches         int // 同じテクスチャで続けて書き出したまとまりの数
+	DrawCalls       int // スプライトの書き出しの命令の数
+	TextureSwitches int // 書き出しの間でテクスチャが切り替わった数
+}
+
+/*
+spatialIndexは、レイヤーのスプライトを書き出される範囲で分類し、範囲内のスプライトを素早く取り出すための索引です。
+画面を一定の大きさのマスに区切り、スプライトを重なるマスに登録します。
+*/
+type spatialIndex struct {
+	cells  map[[2]int32]map[data.SpriteIdentifier]*data.Sprite
+	ranges map[data.SpriteIdentifier][4]int32 // スプライトを登録したマスの範囲（左, 上, 右, 下）
+	always map[data.SpriteIdentifier]*data.Sprite
+}
+
+// newSpatialIndexは、空の空間インデックスを作成します
+func newSpatialIndex() *spatialIndex {
+	return &spatialIndex{
+		cells:  make(map[[2]int32]map[data.SpriteIdentifier]*data.Sprite),
+		ranges: make(map[data.SpriteIdentifier][4]int32),
+		always: make(map[data.SpriteIdentifier]*data.Sprite),
+	}
+}
+
+/*
+putは、スプライトを書き出される範囲に合わせて登録し直します。
+文字列と粒子は範囲を決められないため、常に書き出す候補にします。
+*/
+func (index *spatialIndex) put(sprite *data.Sprite) {
+	index.remove(sprite.Id)
+	if sprite.Kind == data.KindText || sprite.Kind == data.KindEmitter {
+		index.always[sprite.Id] = sprite
+		return
+	}
+	bounds := spriteBounds(sprite)
+	r := cellRange(bounds)
+	if int64(r[2]-r[0]+1)*int64(r[3]-r[1]+1) > maxCullCells {
+		index.always[sprite.Id] = sprite
+		return
+	}
+	for y := r[1]; y <= r[3]; y++ {
+		for x := r[0]; x <= r[2]; x++ {
+			cell, ok := index.cells[[2]int32{x, y}]
+			if !ok {
+				cell = make(map[data.SpriteIdentifier]*data.Sprite)
+				index.cells[[2]int32{x, y}] = cell
+			}
+			cell[sprite.Id] = sprite
+		}
+	}
+	index.ranges[sprite.Id] = r
+}
+
+/*
+removeは、スプライトを索引から取り除きます。
+*/
+func (index *spatialIndex) remove(id data.SpriteIdentifier) {
+	delete(index.always, id)
+	r, ok := index.ranges[id]
+	if !ok {
+		return
+	}
+	for y := r[1]; y <= r[3]; y++ {
+		for x := r[0]; x <= r[2]; x++ {
+			if cell, ok := index.cells[[2]int32{x, y}]; ok {
+				delete(cell, id)
+				if len(cell) == 0 {
+					delete(index.cells, [2]int32{x, y})
+				}
+			}
+		}
+	}
+	delete(index.ranges, id)
+}
+
+/*
+queryは、矩形と重なる可能性のあるスプライトを返します。
+*/
+func (index *spatialIndex) query(rect sdl.Rect) map[data.SpriteIdentifier]*data.Sprite {
+	found := make(map[data.SpriteIdentifier]*data.Sprite, len(index.always))
+	for id, sprite := range index.always {
+		found[id] = sprite
+	}
+	if rect.Empty() {
+		return found
+	}
+	r := cellRange(rect)
+	for y := r[1]; y <= r[3]; y++ {
+		for x := r[0]; x <= r[2]; x++ {
+			for id, sprite := range index.cells[[2]int32{x, y}] {
+				found[id] = sprite
+			}
+		}
+	}
+	return found
+}
+
+// cellRangeは、矩形と重なるマスの範囲（左, 上, 右, 下）を返します
+func cellRange(rect sdl.Rect) [4]int32 {
+	cell := func(v int32) int32 {
+		return int32(math.Floor(float64(v) / cullCellSize))
+	}
+	return [4]int32{cell(rect.X), cell(rect.Y), cell(rect.X + rect.W - 1), cell(rect.Y + rect.H - 1)}
+}
+
+/*
+indexSpriteは、スプライトを登録されているレイヤーの空間インデックスに登録し直します。
+スプライトの位置や大きさを変えた後に呼び出します。
+*/
+func (renderer *Renderer) indexSprite(sprite *data.Sprite) {
+	if index, ok := renderer.layerIndex[sprite.LayerID]; ok {
+		index.put(sprite)
+	}
+}
+
+/*
+unindexSpriteは、スプライトをレイヤーの空間インデックスから取り除きます。
+*/
+func (renderer *Renderer) unindexSprite(layerID data.LayerIdentifier, id data.SpriteIdentifier) {
+	if index, ok := renderer.layerIndex[layerID]; ok {
+		index.remove(id)
+	}
+}
+
+/*
+DrawStatsは、直前のフレームで書き直したレイヤーのスプライトの集計を返します。
+別のgoroutineから呼び出すことができます。
+*/
+func (renderer *Renderer) DrawStats() DrawStats {
+	renderer.mtxStats.Lock()
+	defer renderer.mtxStats.Unlock()
+	return renderer.drawStats
+}
@@ -0,0 +1,36 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestSpatialIndexQuery(t *testing.T) {
+	index := newSpatialIndex()
+	near := data.NewSprite(0)
+	near.DistRect = data.Rect{Left: 10, Top: 10, Width: 32, Height: 32}
+	far := data.NewSprite(0)
+	far.DistRect = data.Rect{Left: 2000, Top: 2000, Width: 32, Height: 32}
+	label := data.NewSprite(0)
+	label.Kind = data.KindText
+	index.put(&near)
+	index.put(&far)
+	index.put(&label)
+
+	found := index.query(sdl.Rect{X: 0, Y: 0, W: 320, H: 240})
+	if len(found) != 2 || found[near.Id] == nil || found[label.Id] == nil {
+		t.Errorf("want near sprite and text, got %d sprites", len(found))
+	}
+	// 移動すると登録し直される
+	far.DistRect.Left, far.DistRect.Top = 100, 100
+	index.put(&far)
+	if found := index.query(sdl.Rect{X: 0, Y: 0, W: 320, H: 240}); found[far.Id] == nil {
+		t.Error("moved sprite should be found")
+	}
+	index.remove(far.Id)
+	if len(index.ranges) != 1 || len(index.query(sdl.Rect{X: 200, Y: 200, W: 32, H: 32})) != 1 {
+		t.Error("removed sprite should not remain")
+	}
+}
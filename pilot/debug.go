@@ -0,0 +1,378 @@
+package pilot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// デバッグ表示の文字の大きさ（拡大前のピクセル）
+	debugGlyphWidth  = 3
+	debugGlyphHeight = 5
+	// デバッグ表示のフレーム時間のグラフの高さ（拡大前のピクセル）
+	debugGraphHeight = 30
+)
+
+/*
+debugGlyphsは、デバッグ表示に使う3×5ピクセルの文字です。
+一行を3ビット（左が4、中央が2、右が1）とし、上の行から順に8進数の各桁に並べています。
+*/
+var debugGlyphs = map[rune]uint16{
+	'0': 075557, '1': 026227, '2': 071747, '3': 071717, '4': 055711,
+	'5': 074717, '6': 074757, '7': 071111, '8': 075757, '9': 075717,
+	'A': 025755, 'B': 065656, 'C': 034443, 'D': 065556, 'E': 074647,
+	'F': 074644, 'G': 034553, 'H': 055755, 'I': 072227, 'J': 011152,
+	'K': 055655, 'L': 044447, 'M': 057755, 'N': 065555, 'O': 025552,
+	'P': 065644, 'Q': 025563, 'R': 065655, 'S': 034216, 'T': 072222,
+	'U': 055557, 'V': 055552, 'W': 055775, 'X': 055255, 'Y': 055222,
+	'Z': 071247, ' ': 000000, '.': 000002, ',': 000024, ':': 002020,
+	'-': 000700, '+': 002720, '=': 007070, '/': 011244, '(': 012221,
+	')': 042224, '[': 032223, ']': 062226, '%': 051245, '#': 057575,
+	'_': 000007, '?': 071202, '>': 042124, '<': 012421, '*': 005250,
+	'!': 022202, '\'': 022000,
+}
+
+/*
+debugBacklogは、チャンネルに溜まっている送受信待ちの数です。
+*/
+type debugBacklog struct {
+	directions int // 描画の指示のチャンネル
+	sounds     int // 音声の再生指示のチャンネル
+	events     int // Appへ送るイベントのチャンネルと送信待ち
+}
+
+/*
+debugViewは、デバッグ表示でスプライトの範囲を書き出す表示領域です。
+ビューポートを使わない場合は画面全体の一つで、使う場合はビューポートごとにカメラの座標を画面の座標に変換します。
+*/
+type debugView struct {
+	camera   sdl.Rect       // 見えている範囲（スプライトの座標）
+	viewport *data.Viewport // 座標を変換するビューポート（nilなら変換しない）
+}
+
+// toScreenは、スプライトの座標を論理解像度の画面の座標に変換します
+func (view *debugView) toScreen(p fpoint) sdl.Point {
+	if view.viewport != nil {
+		p.x, p.y = view.viewport.ToScreen(p.x, p.y)
+	}
+	return sdl.Point{X: int32(math.Round(p.x)), Y: int32(math.Round(p.y))}
+}
+
+/*
+debugViewsは、レイヤーのスプライトの範囲を書き出す表示領域を返します。
+ビューポートを使う場合は、そのレイヤーを書き出すビューポートをIDの順に返します。
+*/
+func (renderer *Renderer) debugViews(layerID data.LayerIdentifier) []debugView {
+	if len(renderer.viewports) == 0 {
+		return []debugView{{camera: sdl.Rect{W: renderer.logicalW, H: renderer.logicalH}}}
+	}
+	var views []debugView
+	for _, id := range renderer.viewportIDs() {
+		viewport := &renderer.viewports[id].viewport
+		if viewport.Contains(layerID) {
+			views = append(views, debugView{camera: *viewport.Camera.ToSdlRect(), viewport: viewport})
+		}
+	}
+	return views
+}
+
+/*
+drawDebugSpritesは、スプライトの範囲を表示領域ごとに書き出します。
+ビューポートの場合は、ビューポートの外に枠がはみ出さないようにします。
+colorがnilの場合は、スプライトの状態に応じた色で書き出します。
+*/
+func (renderer *Renderer) drawDebugSprites(sprites []*data.Sprite, views []debugView, color *data.Color, scale int32) error {
+	r := renderer.SdlRenderer
+	defer r.SetClipRect(nil)
+	for i := range views {
+		view := &views[i]
+		if view.viewport != nil {
+			if err := r.SetClipRect(view.viewport.Screen.ToSdlRect()); err != nil {
+				return err
+			}
+		}
+		for _, sprite := range sprites {
+			c := renderer.debugSpriteColor(sprite, view.camera)
+			if color != nil {
+				c = *color
+			}
+			if err := renderer.drawDebugSprite(sprite, c, scale, view); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+debugOverlayは、デバッグ表示の状態とPilotから受け取った情報です。
+*/
+type debugOverlay struct {
+	enabled bool
+	stats   FrameStats
+	times   []time.Duration // 直近のフレーム時間（古い順）
+	backlog debugBacklog
+	applied int // 直前のフレームで反映した描画の指示の数
+}
+
+/*
+SetDebugOverlayは、デバッグ表示を有効・無効にします。
+デバッグ表示では、スプライトの範囲と基準点、レイヤーの一覧、カーソルの下のスプライト、フレーム時間のグラフ、
+スプライトとテクスチャの数、チャンネルの送受信待ちの数を画面に重ねます。画面の保存には含まれません。
+*/
+func (renderer *Renderer) SetDebugOverlay(enabled bool) {
+	renderer.debug.enabled = enabled
+}
+
+/*
+DebugOverlayは、デバッグ表示が有効か否かを返します。
+*/
+func (renderer *Renderer) DebugOverlay() bool {
+	return renderer.debug.enabled
+}
+
+/*
+setDebugInfoは、デバッグ表示に使うフレーム時間とチャンネルの情報を受け取ります。
+*/
+func (renderer *Renderer) setDebugInfo(stats FrameStats, times []time.Duration, backlog debugBacklog) {
+	renderer.debug.stats = stats
+	renderer.debug.times = times
+	renderer.debug.backlog = backlog
+}
+
+/*
+drawDebugOverlayは、デバッグ表示を論理解像度の画面に重ねます。DrawLayersで画面の保存を行った後に呼び出されます。
+スプライトの範囲は、書き出されるものを緑、画面外のものを灰色、非表示のものを青、画像が無いものを赤、
+カーソルの下にあるものを黄色の枠で示します。
+*/
+func (renderer *Renderer) drawDebugOverlay() error {
+	if !renderer.debug.enabled {
+		return nil
+	}
+	r := renderer.SdlRenderer
+	if err := r.SetRenderTarget(renderer.screen); err != nil {
+		return err
+	}
+	r.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	scale := renderer.logicalH/360 + 1
+
+	var lines []string
+	sprites, textures := 0, make(map[*sdl.Texture]bool)
+	for _, si := range renderer.SpriteImages {
+		textures[si.SpriteTable] = true
+	}
+	for _, id := range renderer.getLayerIDs() {
+		property := renderer.layerProperties[id]
+		layer := renderer.Layers[id]
+		sprites += len(layer)
+		line := fmt.Sprintf("L%d %s %d SPRITES", id, property.Name, len(layer))
+		if property.Hidden {
+			lines = append(lines, line+" HIDDEN")
+			continue
+		}
+		lines = append(lines, line)
+		sprites := make([]*data.Sprite, 0, len(layer))
+		for _, sprite := range layer {
+			sprites = append(sprites, sprite)
+		}
+		if err := renderer.drawDebugSprites(sprites, renderer.debugViews(id), nil, scale); err != nil {
+			return err
+		}
+	}
+	pointer := renderer.pointer
+	if hover, ok := renderer.findSprite(pointer.hover); ok {
+		color := data.Color{R: 255, G: 255, A: 255}
+		if err := renderer.drawDebugSprites([]*data.Sprite{hover}, renderer.debugViews(hover.LayerID), &color, scale); err != nil {
+			return err
+		}
+	}
+
+	stats, draw, backlog := renderer.debug.stats, renderer.DrawStats(), renderer.debug.backlog
+	assets := renderer.AssetReport()
+	hover := "-"
+	if pointer.hover != (data.SpriteIdentifier{}) {
+		hover = shortSpriteID(pointer.hover)
+	}
+	lines = append([]string{
+		fmt.Sprintf("FPS %.1f AVG %s P99 %s MAX %s DROP %d",
+			stats.FPS, debugMillis(stats.Average), debugMillis(stats.P99), debugMillis(stats.Max), stats.Dropped),
+		fmt.Sprintf("SPRITES %d DRAWN %d CULLED %d LAYERS %d", sprites, draw.Drawn, draw.Culled, draw.Layers),
+		fmt.Sprintf("CALLS %d BATCHES %d SWITCHES %d", draw.DrawCalls, draw.Batches, draw.TextureSwitches),
+		fmt.Sprintf("TEXTURES %d IMAGES %d FILES %d %dKB",
+			len(textures), len(renderer.SpriteImages), len(assets.Textures), assets.Bytes/1024),
+		fmt.Sprintf("QUEUE DIR %d SND %d EVT %d APPLIED %d",
+			backlog.directions, backlog.sounds, backlog.events, renderer.debug.applied),
+		fmt.Sprintf("POINTER %d,%d HOVER %s", pointer.x, pointer.y, hover),
+	}, lines...)
+
+	// 文字の背景を暗くしてから書き出す
+	advance := (debugGlyphWidth + 1) * scale
+	lineHeight := (debugGlyphHeight + 2) * scale
+	width := int32(frameHistorySize) * scale
+	for _, line := range lines {
+		if w := int32(len([]rune(line))) * advance; w > width {
+			width = w
+		}
+	}
+	panel := sdl.Rect{
+		X: 2 * scale,
+		Y: 2 * scale,
+		W: width + 4*scale,
+		H: int32(len(lines))*lineHeight + (debugGraphHeight+6)*scale,
+	}
+	r.SetDrawColor(0, 0, 0, 160)
+	if err := r.FillRect(&panel); err != nil {
+		return err
+	}
+	var glyphs []sdl.Rect
+	for i, line := range lines {
+		glyphs = append(glyphs, debugTextRects(line, panel.X+2*scale, panel.Y+2*scale+int32(i)*lineHeight, scale)...)
+	}
+	r.SetDrawColor(255, 255, 255, 255)
+	if len(glyphs) > 0 {
+		if err := r.FillRects(glyphs); err != nil {
+			return err
+		}
+	}
+	graph := sdl.Rect{
+		X: panel.X + 2*scale,
+		Y: panel.Y + 2*scale + int32(len(lines))*lineHeight,
+		W: int32(frameHistorySize) * scale,
+		H: debugGraphHeight * scale,
+	}
+	return renderer.drawDebugGraph(graph, scale)
+}
+
+/*
+debugSpriteColorは、スプライトの状態に応じた枠の色を返します。cameraは表示領域の見えている範囲です。
+*/
+func (renderer *Renderer) debugSpriteColor(sprite *data.Sprite, camera sdl.Rect) data.Color {
+	if sprite.Kind == data.KindImage {
+		if _, ok := renderer.SpriteImages[sprite.SrcImageID]; !ok {
+			return data.Color{R: 255, A: 255}
+		}
+	}
+	if sprite.Hidden {
+		return data.Color{R: 64, G: 128, B: 255, A: 160}
+	}
+	bounds := spriteBounds(sprite)
+	if sprite.Kind != data.KindText && sprite.Kind != data.KindEmitter && !camera.HasIntersection(&bounds) {
+		return data.Color{R: 128, G: 128, B: 128, A: 160}
+	}
+	return data.Color{G: 255, A: 200}
+}
+
+/*
+drawDebugSpriteは、スプライトの書き出し先の矩形を回転を含めた枠で示し、回転・拡大の中心に十字を書き出します。
+座標は表示領域の変換で画面の座標にします。
+*/
+func (renderer *Renderer) drawDebugSprite(sprite *data.Sprite, color data.Color, scale int32, view *debugView) error {
+	r := renderer.SdlRenderer
+	r.SetDrawColor(color.R, color.G, color.B, color.A)
+	w, h := float64(sprite.DistRect.Width), float64(sprite.DistRect.Height)
+	var points []sdl.Point
+	for _, c := range []fpoint{{0, 0}, {w, 0}, {w, h}, {0, h}, {0, 0}} {
+		points = append(points, view.toScreen(transformPoint(sprite, c)))
+	}
+	if err := r.DrawLines(points); err != nil {
+		return err
+	}
+	left, top, cx, cy := spriteOrigin(sprite)
+	center := view.toScreen(fpoint{left + cx, top + cy})
+	x, y := center.X, center.Y
+	size := 2 * scale
+	if err := r.DrawLine(x-size, y, x+size, y); err != nil {
+		return err
+	}
+	return r.DrawLine(x, y-size, x, y+size)
+}
+
+/*
+drawDebugGraphは、直近のフレーム時間を棒グラフで書き出します。
+グラフの高さの半分が60FPSの間隔で、その1.5倍を超えたフレームを赤で示します。
+*/
+func (renderer *Renderer) drawDebugGraph(graph sdl.Rect, scale int32) error {
+	r := renderer.SdlRenderer
+	var good, slow []sdl.Rect
+	for i, d := range renderer.debug.times {
+		ratio := math.Min(float64(d)/float64(defaultFrameInterval*2), 1)
+		bar := int32(math.Round(ratio * float64(graph.H)))
+		rect := sdl.Rect{X: graph.X + int32(i)*scale, Y: graph.Y + graph.H - bar, W: scale, H: bar}
+		if d > defaultFrameInterval*3/2 {
+			slow = append(slow, rect)
+		} else {
+			good = append(good, rect)
+		}
+	}
+	for _, bars := range []struct {
+		rects []sdl.Rect
+		color data.Color
+	}{
+		{good, data.Color{G: 200, B: 255, A: 255}},
+		{slow, data.Color{R: 255, G: 64, B: 64, A: 255}},
+	} {
+		if len(bars.rects) == 0 {
+			continue
+		}
+		r.SetDrawColor(bars.color.R, bars.color.G, bars.color.B, bars.color.A)
+		if err := r.FillRects(bars.rects); err != nil {
+			return err
+		}
+	}
+	r.SetDrawColor(255, 255, 255, 128)
+	target := graph.Y + graph.H/2
+	return r.DrawLine(graph.X, target, graph.X+graph.W, target)
+}
+
+/*
+debugTextRectsは、文字列を内蔵の文字で(x, y)から書き出すための塗りつぶす矩形の一覧を返します。
+小文字は大文字として、内蔵の文字に無いものは「?」として書き出します。
+*/
+func debugTextRects(text string, x, y, scale int32) []sdl.Rect {
+	var rects []sdl.Rect
+	for i, ch := range []rune(strings.ToUpper(text)) {
+		bits, ok := debugGlyphs[ch]
+		if !ok {
+			bits = debugGlyphs['?']
+		}
+		left := x + int32(i)*(debugGlyphWidth+1)*scale
+		for row := int32(0); row < debugGlyphHeight; row++ {
+			line := bits >> uint(3*(debugGlyphHeight-1-row)) & 7
+			for col := int32(0); col < debugGlyphWidth; col++ {
+				if line&(4>>uint(col)) != 0 {
+					rects = append(rects, sdl.Rect{X: left + col*scale, Y: y + row*scale, W: scale, H: scale})
+				}
+			}
+		}
+	}
+	return rects
+}
+
+// debugMillisは、時間をミリ秒の表記にします
+func debugMillis(d time.Duration) string {
+	return fmt.Sprintf("%.1fMS", float64(d)/float64(time.Millisecond))
+}
+
+// shortSpriteIDは、スプライトIDの末尾を表示用に返します
+func shortSpriteID(id data.SpriteIdentifier) string {
+	return fmt.Sprintf("%X", id[8:])
+}
+
+/*
+recentは、記録したフレーム時間を古い順に返します。
+*/
+func (clock *frameClock) recent() []time.Duration {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	times := make([]time.Duration, 0, clock.historyLen)
+	start := (clock.historyPos - clock.historyLen + frameHistorySize) % frameHistorySize
+	for i := 0; i < clock.historyLen; i++ {
+		times = append(times, clock.history[(start+i)%frameHistorySize])
+	}
+	return times
+}
@@ -0,0 +1,40 @@
+package pilot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestDebugTextRects(t *testing.T) {
+	// 「1」は8ピクセル。2文字目は(幅+間隔)×拡大率だけ右にずれる
+	rects := debugTextRects("11", 10, 20, 2)
+	if len(rects) != 16 {
+		t.Fatalf("want 16 rects, got %d", len(rects))
+	}
+	if rects[0] != (sdl.Rect{X: 12, Y: 20, W: 2, H: 2}) || rects[8].X != rects[0].X+8 {
+		t.Errorf("rects: %v %v", rects[0], rects[8])
+	}
+	// 小文字は大文字、無い文字は「?」として書き出す
+	if len(debugTextRects("a", 0, 0, 1)) != len(debugTextRects("A", 0, 0, 1)) {
+		t.Errorf("lowercase differs from uppercase")
+	}
+	if len(debugTextRects("@", 0, 0, 1)) != len(debugTextRects("?", 0, 0, 1)) {
+		t.Errorf("unknown glyph is not drawn as '?'")
+	}
+}
+
+func TestFrameClockRecent(t *testing.T) {
+	clock := frameClock{}
+	for i := 1; i <= frameHistorySize+3; i++ {
+		clock.record(time.Duration(i) * time.Millisecond)
+	}
+	times := clock.recent()
+	if len(times) != frameHistorySize {
+		t.Fatalf("len: %d", len(times))
+	}
+	if times[0] != 4*time.Millisecond || times[len(times)-1] != time.Duration(frameHistorySize+3)*time.Millisecond {
+		t.Errorf("order: first %v last %v", times[0], times[len(times)-1])
+	}
+}
@@ -0,0 +1,165 @@
+package pilot
+
+import (
+	"github.com/collabologic/theater/data"
+)
+
+/*
+Directは、App側からの描画の指示を受け付けます。
+受け付けた指示は、次のフレームの書き出し前にApplyDirectionsで順番に反映されます。
+別のgoroutineから呼び出すことができます。
+*/
+func (renderer *Renderer) Direct(direction data.Direction) {
+	renderer.mtxDirections.Lock()
+	renderer.directions = append(renderer.directions, direction)
+	renderer.mtxDirections.Unlock()
+}
+
+/*
+ApplyDirectionsは、受け付けた描画の指示を順番に反映します。
+画面描画と同じスレッドから呼び出す必要があります。
+*/
+func (renderer *Renderer) ApplyDirections() error {
+	renderer.mtxDirections.Lock()
+	directions := renderer.directions
+	renderer.directions = nil
+	renderer.mtxDirections.Unlock()
+	renderer.debug.applied = len(directions)
+	for i := range directions {
+		if err := renderer.applyDirection(&directions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+applyDirectionは、描画の指示を一件反映します。
+*/
+func (renderer *Renderer) applyDirection(direction *data.Direction) error {
+	switch direction.Code {
+	case data.SpritePut:
+		if direction.Sprite != nil {
+			renderer.addSprite(direction.Sprite)
+		}
+	case data.SpriteRemove:
+		renderer.RemoveSprite(direction.SpriteID)
+	case data.SpriteHide, data.SpriteShow:
+		if sprite, ok := renderer.findSprite(direction.SpriteID); ok {
+			sprite.Hidden = direction.Code == data.SpriteHide
+			renderer.localSprite(sprite).Hidden = sprite.Hidden
+			renderer.markSpriteDirty(sprite)
+		}
+	case data.SpriteMove:
+		if sprite, ok := renderer.findSprite(direction.SpriteID); ok {
+			moved := renderer.localSprite(sprite).Clone()
+			moved.LayerID = direction.LayerID
+			moved.Tweens = nil
+			renderer.addSprite(moved)
+		}
+	case data.LayerClear:
+		renderer.ClearLayer(direction.LayerID)
+	case data.LayerRemove:
+		renderer.RemoveLayer(direction.LayerID)
+	case data.EmitterStart, data.EmitterStop, data.EmitterBurst:
+		renderer.directEmitter(direction)
+	case data.LayerAdd:
+		return renderer.AddLayerWithProperty(direction.LayerID, direction.Layer)
+	case data.LayerSetProperty:
+		renderer.SetLayerProperty(direction.LayerID, direction.Layer)
+	case data.TransitionStart:
+		return renderer.StartTransition(direction.Transition)
+	case data.CaptureStart:
+		renderer.StartCapture(direction.Capture)
+	case data.CaptureStop:
+		renderer.StopCapture()
+	case data.ImagePut:
+		image := direction.Image
+		if image.Image != nil {
+			return renderer.PutImage(image.ID, image.Image)
+		}
+		return renderer.PutImageRGBA(image.ID, image.Pixels, int(image.Width)*4, image.Width, image.Height)
+	case data.ImageCompose:
+		return renderer.ComposeImage(direction.Compose)
+	case data.ImageRemove:
+		renderer.RemoveImage(direction.Image.ID)
+	case data.AssetLoad:
+		_, err := renderer.LoadImage(direction.Asset.Name, direction.Asset.Filename, direction.Asset.Rect)
+		return err
+	case data.AssetRelease:
+		renderer.ReleaseImage(direction.Asset.Name)
+	case data.AssetUnload:
+		renderer.UnloadImage(direction.Asset.Name)
+	case data.ViewportSet:
+		return renderer.SetViewport(direction.ViewportID, direction.Viewport)
+	case data.ViewportRemove:
+		renderer.RemoveViewport(direction.ViewportID)
+	}
+	return nil
+}
+
+/*
+findSpriteは、スプライトIDからレイヤーに登録済みのスプライトを取得します。
+*/
+func (renderer *Renderer) findSprite(id data.SpriteIdentifier) (*data.Sprite, bool) {
+	layerID, ok := renderer.spriteLayers[id]
+	if !ok {
+		return nil, false
+	}
+	sprite, ok := renderer.Layers[layerID][id]
+	return sprite, ok
+}
+
+/*
+RemoveSpriteは、スプライトをレイヤーから削除します。
+*/
+func (renderer *Renderer) RemoveSprite(id data.SpriteIdentifier) {
+	sprite, ok := renderer.findSprite(id)
+	if !ok {
+		return
+	}
+	renderer.markSpriteDirty(sprite)
+	renderer.unindexSprite(sprite.LayerID, id)
+	delete(renderer.Layers[sprite.LayerID], id)
+	delete(renderer.spriteLayers, id)
+	delete(renderer.locals, id)
+	delete(renderer.tweens, id)
+	renderer.removeEmitter(sprite)
+}
+
+/*
+ClearLayerは、レイヤーのスプライトを全て削除します。
+*/
+func (renderer *Renderer) ClearLayer(layerID data.LayerIdentifier) {
+	if _, ok := renderer.Layers[layerID]; !ok {
+		return
+	}
+	for id, sprite := range renderer.Layers[layerID] {
+		delete(renderer.spriteLayers, id)
+		delete(renderer.locals, id)
+		delete(renderer.tweens, id)
+		renderer.removeEmitter(sprite)
+	}
+	renderer.Layers[layerID] = make(map[data.SpriteIdentifier]*data.Sprite)
+	renderer.layerIndex[layerID] = newSpatialIndex()
+	renderer.markLayerDirty(layerID)
+}
+
+/*
+RemoveLayerは、レイヤーをスプライトとテクスチャごと削除します。
+*/
+func (renderer *Renderer) RemoveLayer(layerID data.LayerIdentifier) {
+	if _, ok := renderer.Layers[layerID]; !ok {
+		return
+	}
+	renderer.ClearLayer(layerID)
+	if texture, ok := renderer.LayerTextures[layerID]; ok {
+		texture.Destroy()
+	}
+	delete(renderer.Layers, layerID)
+	delete(renderer.LayerTextures, layerID)
+	delete(renderer.LayerUpdated, layerID)
+	delete(renderer.layerProperties, layerID)
+	delete(renderer.layerIndex, layerID)
+	delete(renderer.layerDirty, layerID)
+}
@@ -0,0 +1,57 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestApplyDirectionSprites(t *testing.T) {
+	renderer := &Renderer{}
+	renderer.initState()
+	for _, id := range []data.LayerIdentifier{0, 1} {
+		renderer.Layers[id] = make(map[data.SpriteIdentifier]*data.Sprite)
+		renderer.layerIndex[id] = newSpatialIndex()
+	}
+	apply := func(direction data.Direction) {
+		if err := renderer.applyDirection(&direction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sprite := data.NewSprite(0)
+	sprite.DistRect = data.Rect{Width: 10, Height: 10}
+	direction := data.PutSprite(&sprite)
+	// 送信後に呼び出し元のスプライトを変えても、指示の内容は変わらない
+	sprite.DistRect.Left = 50
+	apply(direction)
+	put, ok := renderer.findSprite(sprite.Id)
+	if !ok || put.DistRect.Left != 0 || put == &sprite {
+		t.Fatalf("put: %v %+v", ok, put.DistRect)
+	}
+	apply(data.HideSprite(sprite.Id))
+	if put, _ := renderer.findSprite(sprite.Id); !put.Hidden {
+		t.Error("sprite should be hidden")
+	}
+	apply(data.ShowSprite(sprite.Id))
+	if put, _ := renderer.findSprite(sprite.Id); put.Hidden {
+		t.Error("sprite should be shown")
+	}
+	apply(data.MoveSprite(sprite.Id, 1))
+	if _, ok := renderer.Layers[0][sprite.Id]; ok {
+		t.Error("moved sprite left in the old layer")
+	}
+	if put, ok := renderer.findSprite(sprite.Id); !ok || put.LayerID != 1 {
+		t.Errorf("move: %v %+v", ok, put)
+	}
+	apply(data.RemoveSprite(sprite.Id))
+	if _, ok := renderer.findSprite(sprite.Id); ok || len(renderer.Layers[1]) != 0 {
+		t.Error("sprite should be removed")
+	}
+	// スプライトを持たない指示は無視する
+	apply(data.Direction{Code: data.SpritePut})
+	apply(data.PutSprite(&sprite))
+	apply(data.ClearLayer(0))
+	if _, ok := renderer.findSprite(sprite.Id); ok || len(renderer.Layers[0]) != 0 {
+		t.Error("layer should be cleared")
+	}
+}
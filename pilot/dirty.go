@@ -0,0 +1,188 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// 一つのレイヤーで個別に管理する更新範囲の上限（超えた場合は一つにまとめる）
+const maxDirtyRects = 16
+
+/*
+dirtyRegionは、レイヤーの中で書き直しが必要な範囲です。
+*/
+type dirtyRegion struct {
+	full  bool       // trueならレイヤー全体を書き直す
+	rects []sdl.Rect // 書き直す矩形（重なるものはまとめる）
+}
+
+/*
+addは、書き直す範囲に矩形を加えます。重なる矩形はまとめます。
+*/
+func (region *dirtyRegion) add(rect sdl.Rect) {
+	if region.full || rect.Empty() {
+		return
+	}
+	for i := 0; i < len(region.rects); {
+		if region.rects[i].HasIntersection(&rect) {
+			rect = region.rects[i].Union(&rect)
+			region.rects = append(region.rects[:i], region.rects[i+1:]...)
+			i = 0
+			continue
+		}
+		i++
+	}
+	region.rects = append(region.rects, rect)
+	if len(region.rects) > maxDirtyRects {
+		union := region.rects[0]
+		for _, r := range region.rects[1:] {
+			union = union.Union(&r)
+		}
+		region.rects = []sdl.Rect{union}
+	}
+}
+
+/*
+markSpriteDirtyは、スプライトが書き出される範囲を書き直しが必要な範囲に加えます。
+更新の前後で二回呼び出すことで、移動元と移動先の両方を書き直します。
+*/
+func (renderer *Renderer) markSpriteDirty(sprite *data.Sprite) {
+	renderer.LayerUpdated[sprite.LayerID] = true
+	region := renderer.dirtyRegion(sprite.LayerID)
+	if sprite.Kind == data.KindText {
+		// 文字列は矩形からはみ出すことがあるため、レイヤー全体を書き直す
+		region.full = true
+		return
+	}
+	region.add(spriteBounds(sprite))
+}
+
+/*
+markLayerDirtyは、レイヤー全体を書き直しが必要な範囲とします。
+*/
+func (renderer *Renderer) markLayerDirty(layerID data.LayerIdentifier) {
+	renderer.LayerUpdated[layerID] = true
+	renderer.dirtyRegion(layerID).full = true
+}
+
+// dirtyRegionは、レイヤーの書き直しが必要な範囲を取得します
+func (renderer *Renderer) dirtyRegion(layerID data.LayerIdentifier) *dirtyRegion {
+	region, ok := renderer.layerDirty[layerID]
+	if !ok {
+		region = &dirtyRegion{}
+		renderer.layerDirty[layerID] = region
+	}
+	return region
+}
+
+/*
+spriteOriginは、拡大前の書き出し先の矩形の左上と、矩形の中の回転・拡大の中心を小数で返します。
+UsePivotがtrueの場合は、位置を基準点の位置とし、基準点を中心とします。
+*/
+func spriteOrigin(sprite *data.Sprite) (left, top, cx, cy float64) {
+	pos := sprite.Position()
+	if !sprite.UsePivot {
+		return pos.X, pos.Y, float64(sprite.Rotate.CenterX), float64(sprite.Rotate.CenterY)
+	}
+	cx = sprite.Pivot.X * float64(sprite.DistRect.Width)
+	cy = sprite.Pivot.Y * float64(sprite.DistRect.Height)
+	return pos.X - cx, pos.Y - cy, cx, cy
+}
+
+/*
+spriteGeometryは、拡大率を反映した書き出し先の矩形（左上と大きさ）と、矩形の中の回転の中心を小数で返します。
+*/
+func spriteGeometry(sprite *data.Sprite) (x, y, w, h, px, py float64) {
+	// 回転の中心を基準に拡大する
+	left, top, cx, cy := spriteOrigin(sprite)
+	px, py = cx*sprite.ScaleX, cy*sprite.ScaleY
+	w = float64(sprite.DistRect.Width) * sprite.ScaleX
+	h = float64(sprite.DistRect.Height) * sprite.ScaleY
+	return left + cx - px, top + cy - py, w, h, px, py
+}
+
+/*
+spriteDistは、拡大率を反映した書き出し先の矩形を含む整数の矩形と、矩形の中の回転の中心を返します。
+*/
+func spriteDist(sprite *data.Sprite) (sdl.Rect, sdl.Point) {
+	x, y, w, h, px, py := spriteGeometry(sprite)
+	left, top := math.Floor(x), math.Floor(y)
+	dist := sdl.Rect{
+		X: int32(left),
+		Y: int32(top),
+		W: int32(math.Ceil(x+w-1e-9) - left),
+		H: int32(math.Ceil(y+h-1e-9) - top),
+	}
+	point := sdl.Point{X: int32(math.Round(x + px - left)), Y: int32(math.Round(y + py - top))}
+	return dist, point
+}
+
+/*
+spriteBoundsは、回転を含めてスプライトが書き出される範囲を囲む矩形を返します。
+頂点を使う図形は、DistRectの外にある頂点も含めます。
+*/
+func spriteBounds(sprite *data.Sprite) sdl.Rect {
+	if sprite.Kind == data.KindShape && len(sprite.Shape.Points) > 0 {
+		return pointsBounds(sprite)
+	}
+	dist, point := spriteDist(sprite)
+	if sprite.Kind == data.KindShape {
+		// 線は頂点から太さの半分だけはみ出す
+		pad := int32(math.Ceil(float64(sprite.Shape.Thickness)/2*math.Max(sprite.ScaleX, sprite.ScaleY))) + 1
+		dist = sdl.Rect{X: dist.X - pad, Y: dist.Y - pad, W: dist.W + 2*pad, H: dist.H + 2*pad}
+		point = sdl.Point{X: point.X + pad, Y: point.Y + pad}
+	}
+	if sprite.Rotate.Angle == 0 {
+		return sdl.Rect{X: dist.X - 1, Y: dist.Y - 1, W: dist.W + 2, H: dist.H + 2}
+	}
+	rad := sprite.Rotate.Angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	cx, cy := float64(dist.X+point.X), float64(dist.Y+point.Y)
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range [][2]float64{{0, 0}, {float64(dist.W), 0}, {0, float64(dist.H)}, {float64(dist.W), float64(dist.H)}} {
+		x, y := c[0]-float64(point.X), c[1]-float64(point.Y)
+		rx, ry := cx+x*cos-y*sin, cy+x*sin+y*cos
+		minX, maxX = math.Min(minX, rx), math.Max(maxX, rx)
+		minY, maxY = math.Min(minY, ry), math.Max(maxY, ry)
+	}
+	return sdl.Rect{
+		X: int32(math.Floor(minX)) - 1,
+		Y: int32(math.Floor(minY)) - 1,
+		W: int32(math.Ceil(maxX-minX)) + 3,
+		H: int32(math.Ceil(maxY-minY)) + 3,
+	}
+}
+
+/*
+pointsBoundsは、頂点を使う図形が書き出される範囲を囲む矩形を返します。
+頂点を囲む矩形の四隅を拡大・裏返し・回転し、線の太さの半分だけ広げます。
+*/
+func pointsBounds(sprite *data.Sprite) sdl.Rect {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range sprite.Shape.Points {
+		// 頂点はピクセルの中心として扱う
+		x, y := float64(p.X)+0.5, float64(p.Y)+0.5
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	corners := []fpoint{{minX, minY}, {maxX, minY}, {minX, maxY}, {maxX, maxY}}
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		p := transformPoint(sprite, c)
+		minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	pad := math.Max(float64(sprite.Shape.Thickness), 1)/2*math.Max(math.Abs(sprite.ScaleX), math.Abs(sprite.ScaleY)) + 1
+	left, top := math.Floor(minX-pad), math.Floor(minY-pad)
+	return sdl.Rect{
+		X: int32(left),
+		Y: int32(top),
+		W: int32(math.Ceil(maxX+pad)-left) + 1,
+		H: int32(math.Ceil(maxY+pad)-top) + 1,
+	}
+}
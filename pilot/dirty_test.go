@@ -0,0 +1,152 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestSpriteGeometryPivot(t *testing.T) {
+	sprite := data.NewSprite(0)
+	sprite.DistRect = data.Rect{Width: 20, Height: 10}
+	sprite.SetPosition(100.25, 50)
+	// 下端の中央を基準点にして2倍に拡大する
+	sprite.SetPivot(0.5, 1)
+	sprite.ScaleX, sprite.ScaleY = 2, 2
+	x, y, w, h, px, py := spriteGeometry(&sprite)
+	if x != 80.25 || y != 30 || w != 40 || h != 20 || px != 20 || py != 20 {
+		t.Errorf("unexpected geometry: %v %v %v %v %v %v", x, y, w, h, px, py)
+	}
+	// 整数の矩形は小数の矩形を含む
+	dist, point := spriteDist(&sprite)
+	if dist != (sdl.Rect{X: 80, Y: 30, W: 41, H: 20}) || point != (sdl.Point{X: 20, Y: 20}) {
+		t.Errorf("unexpected dist: %+v %+v", dist, point)
+	}
+	// Left, Topを直接変えた向きでは、古い小数部分を使わない
+	moved := sprite.Clone()
+	moved.DistRect.Left = 120
+	if pos := moved.Position(); pos.X != 120 || pos.Y != 50 {
+		t.Errorf("stale sub pixel: %+v", pos)
+	}
+	// 基準点は拡大しても動かない
+	p := transformPoint(&sprite, fpoint{10, 10})
+	if p.x != 100.25 || p.y != 50 {
+		t.Errorf("pivot moved: %+v", p)
+	}
+}
+
+func TestSpriteBoundsPoints(t *testing.T) {
+	sprite := data.NewSprite(0)
+	sprite.Kind = data.KindShape
+	sprite.DistRect = data.Rect{Left: 100, Top: 100, Width: 10, Height: 10}
+	// DistRectの外にある頂点も範囲に含める
+	sprite.Shape = data.Shape{Type: data.ShapeLine, Points: []data.Point{{X: -50, Y: 5}, {X: 60, Y: 30}}}
+	bounds := spriteBounds(&sprite)
+	inside := func(x, y int32) bool {
+		return x >= bounds.X && x < bounds.X+bounds.W && y >= bounds.Y && y < bounds.Y+bounds.H
+	}
+	if !inside(50, 105) || !inside(160, 130) {
+		t.Errorf("points outside bounds: %+v", bounds)
+	}
+	// 拡大・回転しても頂点を囲む
+	sprite.ScaleX, sprite.ScaleY = 2, 2
+	sprite.Rotate.Angle = 90
+	bounds = spriteBounds(&sprite)
+	for _, p := range sprite.Shape.Points {
+		q := transformPoint(&sprite, fpoint{float64(p.X) + 0.5, float64(p.Y) + 0.5})
+		if !inside(int32(q.x), int32(q.y)) {
+			t.Errorf("point %+v outside bounds %+v", q, bounds)
+		}
+	}
+}
+
+func TestDirtyRegionAdd(t *testing.T) {
+	cases := []struct {
+		name  string
+		rects []sdl.Rect
+		want  []sdl.Rect
+	}{
+		{"disjoint", []sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 20, Y: 0, W: 10, H: 10}},
+			[]sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 20, Y: 0, W: 10, H: 10}}},
+		{"overlap", []sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 5, Y: 5, W: 10, H: 10}},
+			[]sdl.Rect{{X: 0, Y: 0, W: 15, H: 15}}},
+		{"touching edges stay apart", []sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 10, Y: 0, W: 10, H: 10}},
+			[]sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 10, Y: 0, W: 10, H: 10}}},
+		// 間をつなぐ矩形を加えると、まとめた矩形が別の矩形と重なる場合もまとめる
+		{"chain", []sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 30, Y: 0, W: 10, H: 10}, {X: 5, Y: 0, W: 30, H: 5}},
+			[]sdl.Rect{{X: 0, Y: 0, W: 40, H: 10}}},
+		{"empty", []sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}, {X: 50, Y: 50, W: 0, H: 10}},
+			[]sdl.Rect{{X: 0, Y: 0, W: 10, H: 10}}},
+	}
+	for _, c := range cases {
+		region := dirtyRegion{}
+		for _, r := range c.rects {
+			region.add(r)
+		}
+		if len(region.rects) != len(c.want) {
+			t.Errorf("%s: want %v, got %v", c.name, c.want, region.rects)
+			continue
+		}
+		for i := range c.want {
+			if region.rects[i] != c.want[i] {
+				t.Errorf("%s: want %v, got %v", c.name, c.want, region.rects)
+				break
+			}
+		}
+	}
+}
+
+func TestDirtyRegionLimit(t *testing.T) {
+	region := dirtyRegion{}
+	for i := int32(0); i < maxDirtyRects; i++ {
+		region.add(sdl.Rect{X: i * 20, Y: 0, W: 10, H: 10})
+	}
+	if len(region.rects) != maxDirtyRects {
+		t.Fatalf("rects: %d", len(region.rects))
+	}
+	// 上限を超えたら全てを囲む一つの矩形にまとめる
+	region.add(sdl.Rect{X: 0, Y: 100, W: 10, H: 10})
+	want := sdl.Rect{X: 0, Y: 0, W: (maxDirtyRects-1)*20 + 10, H: 110}
+	if len(region.rects) != 1 || region.rects[0] != want {
+		t.Errorf("want %v, got %v", want, region.rects)
+	}
+	// レイヤー全体を書き直す場合は矩形を加えない
+	region.full = true
+	region.add(sdl.Rect{X: 500, Y: 500, W: 10, H: 10})
+	if len(region.rects) != 1 {
+		t.Errorf("full region should ignore rects: %v", region.rects)
+	}
+}
+
+func TestSpriteBoundsTransformed(t *testing.T) {
+	cases := []struct {
+		name   string
+		angle  float64
+		scale  float64
+		width  int32 // 期待する範囲の幅と高さの上限
+		height int32
+	}{
+		{"plain", 0, 1, 22, 12},
+		{"scaled", 0, 2, 42, 22},
+		{"rotated", 90, 1, 13, 23},
+		{"rotated and scaled", 45, 1.5, 37, 37},
+	}
+	for _, c := range cases {
+		sprite := data.NewSprite(0)
+		sprite.DistRect = data.Rect{Left: 100, Top: 100, Width: 20, Height: 10}
+		sprite.Rotate = data.Rotate{CenterX: 10, CenterY: 5, Angle: c.angle}
+		sprite.ScaleX, sprite.ScaleY = c.scale, c.scale
+		bounds := spriteBounds(&sprite)
+		// 拡大・回転した四隅を全て囲む
+		for _, p := range []fpoint{{0, 0}, {20, 0}, {0, 10}, {20, 10}} {
+			q := transformPoint(&sprite, p)
+			if q.x < float64(bounds.X) || q.x > float64(bounds.X+bounds.W) || q.y < float64(bounds.Y) || q.y > float64(bounds.Y+bounds.H) {
+				t.Errorf("%s: corner %+v outside %+v", c.name, q, bounds)
+			}
+		}
+		if bounds.W > c.width || bounds.H > c.height {
+			t.Errorf("%s: bounds too large %+v", c.name, bounds)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package pilot
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/collabologic/theater/data"
+)
+
+const (
+	// 一回のフレームで追いつくために行う更新の最大回数
+	maxCatchUpSteps = 5
+	// フレーム時間の統計に使う直近のフレーム数
+	frameHistorySize = 120
+	// 更新間隔も上限も指定されていない場合に想定するフレームの間隔
+	defaultFrameInterval = time.Second / 60
+	// Appへ送れずに溜めておくイベントの上限（超えた場合は古いものから捨てる）
+	maxPendingEvents = 1024
+)
+
+/*
+FrameStatsは、直近のフレーム時間の統計です。
+*/
+type FrameStats struct {
+	Frames  uint64        // 書き出したフレームの総数
+	Updates uint64        // 行った更新の総数
+	Average time.Duration // 直近のフレーム時間の平均
+	P99     time.Duration // 直近のフレーム時間の99パーセンタイル
+	Max     time.Duration // 直近のフレーム時間の最大
+	FPS     float64       // 直近の平均から求めた毎秒のフレーム数
+	Dropped uint64        // 想定の間隔の1.5倍を超えたフレームの総数
+}
+
+/*
+frameClockは、フレームの間隔と更新のタイミングを管理します。
+更新間隔を指定した場合は、経過時間を固定の間隔の更新に分割します（固定タイムステップ）。
+*/
+type frameClock struct {
+	mtx        sync.Mutex
+	step       time.Duration // 固定の更新間隔（0なら毎フレーム経過時間だけ更新する）
+	limit      time.Duration // 1フレームの最短時間（0なら制限しない）
+	frameStart time.Time     // 現在のフレームの開始時刻
+	lastUpdate time.Time     // 前回の更新の時刻
+	lag        time.Duration // まだ更新に反映していない経過時間
+	simTime    time.Duration // 更新に反映した経過時間の合計
+	updates    uint64
+	frames     uint64
+	dropped    uint64
+	history    [frameHistorySize]time.Duration
+	historyLen int
+	historyPos int
+}
+
+/*
+SetUpdateRateは、一秒あたりの更新回数を設定します。
+0を指定すると、フレームごとに経過時間だけ更新します。
+*/
+func (pilot *Pilot) SetUpdateRate(hz int) {
+	pilot.clock.mtx.Lock()
+	defer pilot.clock.mtx.Unlock()
+	pilot.clock.step = rateInterval(hz)
+}
+
+/*
+SetFPSLimitは、一秒あたりのフレーム数の上限を設定します。0を指定すると制限しません。
+垂直同期を無効にした場合に、フレームの間隔を揃えるために使用します。
+*/
+func (pilot *Pilot) SetFPSLimit(fps int) {
+	pilot.clock.mtx.Lock()
+	defer pilot.clock.mtx.Unlock()
+	pilot.clock.limit = rateInterval(fps)
+}
+
+/*
+FrameStatsは、直近のフレーム時間の統計を返します。別のgoroutineから呼び出すことができます。
+*/
+func (pilot *Pilot) FrameStats() FrameStats {
+	return pilot.clock.stats()
+}
+
+// rateIntervalは、一秒あたりの回数を間隔に変換します
+func rateInterval(hz int) time.Duration {
+	if hz <= 0 {
+		return 0
+	}
+	return time.Second / time.Duration(hz)
+}
+
+/*
+startは、時刻の計測を開始します。
+*/
+func (clock *frameClock) start(now time.Time) {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	clock.frameStart = now
+	clock.lastUpdate = now
+	clock.lag = 0
+}
+
+/*
+advanceは、前回の呼び出しからの経過時間を更新に分割し、各更新の通し番号と経過時間（ミリ秒）を返します。
+固定の更新間隔の場合、処理が遅れても追いつくための更新はmaxCatchUpSteps回までとし、残りは切り捨てます。
+*/
+func (clock *frameClock) advance(now time.Time) []data.Tick {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	clock.lag += now.Sub(clock.lastUpdate)
+	clock.lastUpdate = now
+	var ticks []data.Tick
+	if clock.step <= 0 {
+		ticks = append(ticks, clock.consume(clock.lag))
+		clock.lag = 0
+		return ticks
+	}
+	if maxLag := clock.step * maxCatchUpSteps; clock.lag > maxLag {
+		clock.lag = maxLag
+	}
+	for clock.lag >= clock.step {
+		clock.lag -= clock.step
+		ticks = append(ticks, clock.consume(clock.step))
+	}
+	return ticks
+}
+
+/*
+consumeは、経過時間を一回分の更新に反映します。
+経過時間は合計からミリ秒を求めることで、端数の丸めによるずれが積み重ならないようにします。
+*/
+func (clock *frameClock) consume(d time.Duration) data.Tick {
+	before := clock.simTime.Round(time.Millisecond).Milliseconds()
+	clock.simTime += d
+	clock.updates++
+	return data.Tick{
+		Frame: clock.updates,
+		Delta: uint32(clock.simTime.Round(time.Millisecond).Milliseconds() - before),
+	}
+}
+
+/*
+waitは、フレーム数の上限に合わせて待機してから、フレーム時間を記録し、次のフレームを開始します。
+*/
+func (clock *frameClock) wait() {
+	clock.mtx.Lock()
+	limit := clock.limit
+	start := clock.frameStart
+	clock.mtx.Unlock()
+	if limit > 0 {
+		if rest := limit - time.Since(start); rest > 0 {
+			time.Sleep(rest)
+		}
+	}
+	now := time.Now()
+	clock.record(now.Sub(start))
+	clock.mtx.Lock()
+	clock.frameStart = now
+	clock.mtx.Unlock()
+}
+
+/*
+recordは、一フレームにかかった時間を記録します。
+*/
+func (clock *frameClock) record(d time.Duration) {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	clock.frames++
+	clock.history[clock.historyPos] = d
+	clock.historyPos = (clock.historyPos + 1) % frameHistorySize
+	if clock.historyLen < frameHistorySize {
+		clock.historyLen++
+	}
+	interval := clock.limit
+	if interval <= 0 {
+		interval = clock.step
+	}
+	if interval <= 0 {
+		interval = defaultFrameInterval
+	}
+	if d > interval*3/2 {
+		clock.dropped++
+	}
+}
+
+/*
+statsは、記録したフレーム時間から統計を求めます。
+*/
+func (clock *frameClock) stats() FrameStats {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	stats := FrameStats{
+		Frames:  clock.frames,
+		Updates: clock.updates,
+		Dropped: clock.dropped,
+	}
+	if clock.historyLen == 0 {
+		return stats
+	}
+	times := make([]time.Duration, clock.historyLen)
+	copy(times, clock.history[:clock.historyLen])
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	var sum time.Duration
+	for _, d := range times {
+		sum += d
+	}
+	stats.Average = sum / time.Duration(len(times))
+	stats.P99 = times[(len(times)*99-1)/100]
+	stats.Max = times[len(times)-1]
+	if stats.Average > 0 {
+		stats.FPS = float64(time.Second) / float64(stats.Average)
+	}
+	return stats
+}
+
+/*
+tickQueueは、Appへ送るFrameTickを待たずに送るための送信待ちの更新です。
+チャンネルに空きが無い間の更新は一つにまとめ、Appの処理が遅れても画面描画を止めないようにします。
+*/
+type tickQueue struct {
+	pending data.Tick
+}
+
+// addは、行った更新を送信待ちのFrameTickにまとめます
+func (queue *tickQueue) add(tick data.Tick) {
+	queue.pending.Frame = tick.Frame
+	queue.pending.Delta += tick.Delta
+	queue.pending.Updates++
+}
+
+// flushは、チャンネルに空きがあれば送信待ちのFrameTickを送ります。空きが無ければ待たずに次の機会に送ります
+func (queue *tickQueue) flush(ch chan<- data.Event) {
+	if queue.pending.Updates == 0 {
+		return
+	}
+	select {
+	case ch <- data.Event{Device: data.DeviceClock, Code: data.FrameTick, Tick: queue.pending}:
+		queue.pending = data.Tick{}
+	default:
+	}
+}
+
+/*
+eventQueueは、Appへ送るイベントを待たずに送るための送信待ちのイベントです。
+チャンネルに空きが無い間のイベントは順番を保って溜めておき、Appの処理が遅れても画面描画を止めないようにします。
+*/
+type eventQueue struct {
+	pending []data.Event
+}
+
+// pushは、イベントを送信待ちにします。上限を超えた場合は古いイベントから捨てます
+func (queue *eventQueue) push(events ...data.Event) {
+	queue.pending = append(queue.pending, events...)
+	if over := len(queue.pending) - maxPendingEvents; over > 0 {
+		queue.pending = append(queue.pending[:0], queue.pending[over:]...)
+	}
+}
+
+// flushは、チャンネルに空きがある分だけ送信待ちのイベントを順番に送ります。残りは次の機会に送ります
+func (queue *eventQueue) flush(ch chan<- data.Event) {
+	for len(queue.pending) > 0 {
+		select {
+		case ch <- queue.pending[0]:
+			queue.pending = queue.pending[1:]
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package pilot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestFrameClockFixedStep(t *testing.T) {
+	clock := frameClock{step: time.Second / 60}
+	start := time.Unix(0, 0)
+	clock.start(start)
+	var total uint32
+	// 1秒分を不規則な間隔で進めても、60回の更新で合計1000ミリ秒になる
+	now := start
+	for i := 0; i < 10; i++ {
+		for _, ms := range []int{5, 40, 3, 17, 35} {
+			now = now.Add(time.Duration(ms) * time.Millisecond)
+			for _, tick := range clock.advance(now) {
+				total += tick.Delta
+			}
+		}
+	}
+	if clock.updates != 60 || total != 1000 {
+		t.Errorf("want 60 updates / 1000ms, got %d / %dms", clock.updates, total)
+	}
+	// 大きく遅れた場合は追いつくための更新を制限する
+	ticks := clock.advance(now.Add(time.Second))
+	if len(ticks) != maxCatchUpSteps {
+		t.Errorf("want %d catch-up steps, got %d", maxCatchUpSteps, len(ticks))
+	}
+	if ticks[len(ticks)-1].Frame != 60+maxCatchUpSteps {
+		t.Errorf("frame number: %d", ticks[len(ticks)-1].Frame)
+	}
+}
+
+func TestFrameStats(t *testing.T) {
+	clock := frameClock{}
+	for i := 0; i < 99; i++ {
+		clock.record(10 * time.Millisecond)
+	}
+	clock.record(100 * time.Millisecond)
+	stats := clock.stats()
+	if stats.Frames != 100 || stats.Dropped != 1 {
+		t.Errorf("frames/dropped: %+v", stats)
+	}
+	if stats.Max != 100*time.Millisecond || stats.P99 != 10*time.Millisecond {
+		t.Errorf("max/p99: %+v", stats)
+	}
+}
+
+func TestTickQueueCoalesces(t *testing.T) {
+	ch := make(chan data.Event, 1)
+	var queue tickQueue
+	queue.add(data.Tick{Frame: 1, Delta: 16})
+	queue.flush(ch)
+	// Appが受け取るまでの更新は、待たずに一つにまとめる
+	queue.add(data.Tick{Frame: 2, Delta: 16})
+	queue.flush(ch)
+	queue.add(data.Tick{Frame: 3, Delta: 17})
+	queue.flush(ch)
+	if first := <-ch; first.Tick.Frame != 1 || first.Tick.Updates != 1 {
+		t.Errorf("first tick: %+v", first.Tick)
+	}
+	queue.flush(ch)
+	if second := <-ch; second.Code != data.FrameTick || second.Tick != (data.Tick{Frame: 3, Delta: 33, Updates: 2}) {
+		t.Errorf("coalesced tick: %+v", second.Tick)
+	}
+	queue.flush(ch)
+	if len(ch) != 0 {
+		t.Errorf("nothing should be pending")
+	}
+}
+
+func TestEventQueueKeepsOrder(t *testing.T) {
+	ch := make(chan data.Event, 2)
+	var queue eventQueue
+	queue.push(data.Event{Code: data.KeyPressOn}, data.Event{Code: data.KeyPressOff}, data.Event{Code: data.CollisionEnter})
+	// チャンネルに空きが無い分は待たずに残す
+	queue.flush(ch)
+	if len(ch) != 2 || len(queue.pending) != 1 {
+		t.Fatalf("sent %d, pending %d", len(ch), len(queue.pending))
+	}
+	if first := <-ch; first.Code != data.KeyPressOn {
+		t.Errorf("first event: %v", first.Code)
+	}
+	queue.push(data.Event{Code: data.CollisionExit})
+	queue.flush(ch)
+	var got []data.EventCode
+	for len(ch) > 0 {
+		got = append(got, (<-ch).Code)
+	}
+	queue.flush(ch)
+	got = append(got, (<-ch).Code)
+	want := []data.EventCode{data.KeyPressOff, data.CollisionEnter, data.CollisionExit}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("order: want %v, got %v", want, got)
+	}
+}
+
+func TestEventQueueLimit(t *testing.T) {
+	var queue eventQueue
+	for i := 0; i < maxPendingEvents+10; i++ {
+		queue.push(data.Event{Tick: data.Tick{Frame: uint64(i)}})
+	}
+	// 上限を超えた分は古いものから捨てる
+	if len(queue.pending) != maxPendingEvents || queue.pending[0].Tick.Frame != 10 {
+		t.Errorf("pending %d, oldest %d", len(queue.pending), queue.pending[0].Tick.Frame)
+	}
+}
@@ -0,0 +1,140 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+)
+
+/*
+spriteTransformは、親から受け継ぐスプライトの位置・回転・拡大率・裏返し・不透明度です。
+*/
+type spriteTransform struct {
+	dist     data.Rect
+	position data.FPoint // 小数を含む位置
+	rotate   data.Rotate
+	flip     data.Flip
+	scaleX   float64
+	scaleY   float64
+	alpha    uint8
+	hidden   bool
+}
+
+// transformOfは、スプライトの現在の値を取得します
+func transformOf(sprite *data.Sprite) spriteTransform {
+	return spriteTransform{
+		dist:     sprite.DistRect,
+		position: sprite.Position(),
+		rotate:   sprite.Rotate,
+		flip:     sprite.Flip,
+		scaleX:   sprite.ScaleX,
+		scaleY:   sprite.ScaleY,
+		alpha:    sprite.Alpha,
+		hidden:   sprite.Hidden,
+	}
+}
+
+// applyは、スプライトに値を書き込みます
+func (transform spriteTransform) apply(sprite *data.Sprite) {
+	sprite.DistRect = transform.dist
+	sprite.SetPosition(transform.position.X, transform.position.Y)
+	sprite.Rotate = transform.rotate
+	sprite.Flip = transform.flip
+	sprite.ScaleX = transform.scaleX
+	sprite.ScaleY = transform.scaleY
+	sprite.Alpha = transform.alpha
+	sprite.Hidden = transform.hidden
+}
+
+/*
+childTransformは、親のスプライト（画面上の値）と、親を基準とした子の値から、子の画面上の値を求めます。
+子の回転の中心を親の裏返し・拡大・回転で移し、回転角度と拡大率は足し合わせ・掛け合わせます。
+親の拡大率が縦横で異なる場合、回転した子の形は近似になります。
+親が見つからない場合（parentがnil）は、子を書き出さないようにします。
+*/
+func childTransform(parent, local *data.Sprite) spriteTransform {
+	transform := transformOf(local)
+	if parent == nil {
+		transform.hidden = true
+		return transform
+	}
+	left, top, cx, cy := spriteOrigin(local)
+	pos := local.Position()
+	pivot := transformPoint(parent, fpoint{x: left + cx, y: top + cy})
+	// 位置と回転の中心の差は親の中でも変わらない。誤差で整数部分が変わらないように丸める
+	x := math.Round((pivot.x-(left+cx-pos.X))*1e6) / 1e6
+	y := math.Round((pivot.y-(top+cy-pos.Y))*1e6) / 1e6
+	transform.dist.Left, transform.dist.Top = int32(math.Floor(x)), int32(math.Floor(y))
+	transform.position = data.FPoint{X: x, Y: y}
+	// 片方の向きだけ裏返した親の中では、回転の向きが逆になる
+	angle := local.Rotate.Angle
+	if (parent.Flip&data.Horizontal != 0) != (parent.Flip&data.Vertical != 0) {
+		angle = -angle
+	}
+	transform.rotate.Angle = parent.Rotate.Angle + angle
+	transform.flip = local.Flip ^ parent.Flip
+	transform.scaleX = local.ScaleX * parent.ScaleX
+	transform.scaleY = local.ScaleY * parent.ScaleY
+	transform.alpha = mulColor(local.Alpha, parent.Alpha)
+	transform.hidden = local.Hidden || parent.Hidden
+	return transform
+}
+
+/*
+localSpriteは、Tweenや表示の切り替えを反映する先のスプライトを返します。
+親を持つスプライトの場合は親を基準とした値、それ以外の場合はスプライトそのものです。
+*/
+func (renderer *Renderer) localSprite(sprite *data.Sprite) *data.Sprite {
+	if local, ok := renderer.locals[sprite.Id]; ok {
+		return local
+	}
+	return sprite
+}
+
+/*
+resolveHierarchyは、親を持つスプライトの画面上の位置・回転・拡大率・裏返し・不透明度を親から求め直します。
+親から順に求めるため、孫以下のスプライトにも親の変化が伝わります。値が変わったスプライトは書き直しが必要な範囲に加えます。
+Pilotのフレームごとに、Tweenを進めた後と書き出しの前に呼び出されます。
+*/
+func (renderer *Renderer) resolveHierarchy() {
+	if len(renderer.locals) == 0 {
+		return
+	}
+	resolved := make(map[data.SpriteIdentifier]bool, len(renderer.locals))
+	for id := range renderer.locals {
+		renderer.resolveSprite(id, resolved)
+	}
+}
+
+/*
+resolveSpriteは、スプライトの親を先に求めてから、スプライトの画面上の値を求めます。
+親子が循環している場合は、循環を断ち切った位置の値が前回のままになります。
+*/
+func (renderer *Renderer) resolveSprite(id data.SpriteIdentifier, resolved map[data.SpriteIdentifier]bool) {
+	if resolved[id] {
+		return
+	}
+	resolved[id] = true
+	local, ok := renderer.locals[id]
+	if !ok {
+		return
+	}
+	sprite, ok := renderer.findSprite(id)
+	if !ok {
+		delete(renderer.locals, id)
+		return
+	}
+	renderer.resolveSprite(local.Parent, resolved)
+	parent, ok := renderer.findSprite(local.Parent)
+	if !ok {
+		parent = nil
+	}
+	transform := childTransform(parent, local)
+	if transform == transformOf(sprite) {
+		return
+	}
+	renderer.markSpriteDirty(sprite)
+	transform.apply(sprite)
+	renderer.indexSprite(sprite)
+	renderer.markSpriteDirty(sprite)
+}
@@ -0,0 +1,45 @@
+package pilot
+
+import (
+	"math"
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestChildTransform(t *testing.T) {
+	parent := data.NewSprite(0)
+	parent.DistRect = data.Rect{Left: 100, Top: 50, Width: 20, Height: 20}
+	parent.Rotate = data.Rotate{CenterX: 10, CenterY: 10, Angle: 90}
+	parent.Alpha = 128
+	child := data.NewSprite(0)
+	child.Parent = parent.Id
+	child.DistRect = data.Rect{Left: 20, Top: 0, Width: 4, Height: 4}
+	child.Rotate = data.Rotate{CenterX: 2, CenterY: 2}
+
+	// 親の中心から右上にある子は、親を90度回すと右下に移る
+	got := childTransform(&parent, &child)
+	if got.dist.Left != 116 || got.dist.Top != 70 {
+		t.Errorf("unexpected position: %d,%d", got.dist.Left, got.dist.Top)
+	}
+	if math.Abs(got.rotate.Angle-90) > 1e-9 || got.alpha != 128 || got.hidden {
+		t.Errorf("unexpected transform: %+v", got)
+	}
+
+	// 横に裏返した親の中では、子の回転が逆向きになり裏返しを受け継ぐ
+	parent.Rotate.Angle = 0
+	parent.Flip = data.Horizontal
+	child.Rotate.Angle = 30
+	got = childTransform(&parent, &child)
+	if got.rotate.Angle != -30 || got.flip != data.Horizontal {
+		t.Errorf("unexpected flipped transform: %+v", got)
+	}
+	if got.dist.Left != 100+20-22-2 {
+		t.Errorf("unexpected flipped position: %d", got.dist.Left)
+	}
+
+	// 親が見つからない子は書き出さない
+	if got = childTransform(nil, &child); !got.hidden {
+		t.Error("orphan child should be hidden")
+	}
+}
@@ -0,0 +1,176 @@
+package pilot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+	"unsafe"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+/*
+PutImageは、画像をスプライト画像として登録します。登録済みのIDの場合は画像を置き換えます。
+同じ大きさの作成済みの画像を置き換える場合は、テクスチャを作り直さずに内容だけを更新します。
+*/
+func (renderer *Renderer) PutImage(id data.ImageIdentifier, img image.Image) error {
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) {
+		bounds := img.Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	}
+	return renderer.PutImageRGBA(id, rgba.Pix, rgba.Stride, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()))
+}
+
+/*
+PutImageRGBAは、RGBAの画素をスプライト画像として登録します。pitchは一行のバイト数です。
+*/
+func (renderer *Renderer) PutImageRGBA(id data.ImageIdentifier, pixels []byte, pitch int, width, height int32) error {
+	if width <= 0 || height <= 0 || len(pixels) < pitch*int(height-1)+int(width)*4 {
+		return errors.New(fmt.Sprintf("Invalid image size:%dx%d", width, height))
+	}
+	rect := data.Rect{Width: width, Height: height}
+	if si, ok := renderer.SpriteImages[id]; ok && si.Type == data.Generated && si.Rect == rect {
+		// 同じ大きさなら内容だけを書き換える
+		_, access, _, _, err := si.SpriteTable.Query()
+		if err == nil && access == sdl.TEXTUREACCESS_STATIC {
+			if err := si.SpriteTable.Update(nil, unsafe.Pointer(&pixels[0]), pitch); err != nil {
+				return err
+			}
+			renderer.masks[id] = newAlphaMask(pixels, pitch, rect)
+			renderer.markImageDirty(id)
+			return nil
+		}
+	}
+	texture, err := renderer.SdlRenderer.CreateTexture(
+		uint32(sdl.PIXELFORMAT_RGBA32),
+		sdl.TEXTUREACCESS_STATIC,
+		width,
+		height,
+	)
+	if err != nil {
+		return err
+	}
+	if err = texture.Update(nil, unsafe.Pointer(&pixels[0]), pitch); err != nil {
+		texture.Destroy()
+		return err
+	}
+	if err = texture.SetBlendMode(sdl.BLENDMODE_BLEND); err != nil {
+		texture.Destroy()
+		return err
+	}
+	renderer.setGeneratedImage(id, texture, rect)
+	renderer.masks[id] = newAlphaMask(pixels, pitch, rect)
+	return nil
+}
+
+/*
+ComposeImageは、スプライトを重ねて書き出した画像をスプライト画像として登録します。
+スプライトはPriorityの小さい順に重ね、座標は画像の左上を原点とします。
+*/
+func (renderer *Renderer) ComposeImage(composition data.ImageComposition) error {
+	if composition.Width <= 0 || composition.Height <= 0 {
+		return errors.New(fmt.Sprintf("Invalid image size:%dx%d", composition.Width, composition.Height))
+	}
+	texture, err := renderer.createTargetTexture(composition.Width, composition.Height, FilterNearest)
+	if err != nil {
+		return err
+	}
+	defer renderer.SdlRenderer.SetRenderTarget(nil)
+	if err = renderer.SdlRenderer.SetRenderTarget(texture); err != nil {
+		texture.Destroy()
+		return err
+	}
+	c := composition.Background
+	renderer.SdlRenderer.SetDrawColor(c.R, c.G, c.B, c.A)
+	if err = renderer.SdlRenderer.Clear(); err != nil {
+		texture.Destroy()
+		return err
+	}
+	sprites := make([]*data.Sprite, len(composition.Sprites))
+	for i := range composition.Sprites {
+		sprites[i] = &composition.Sprites[i]
+	}
+	sort.SliceStable(sprites, func(i, j int) bool {
+		return sprites[i].Priority < sprites[j].Priority
+	})
+	for _, sprite := range sprites {
+		if sprite.Hidden {
+			continue
+		}
+		renderer.restoreImages(sprite)
+		if err = renderer.drawSprite(sprite); err != nil {
+			texture.Destroy()
+			return err
+		}
+	}
+	// 当たり判定用に書き出した結果を読み取る
+	rect := data.Rect{Width: composition.Width, Height: composition.Height}
+	pixels := make([]byte, composition.Width*composition.Height*4)
+	if err = renderer.SdlRenderer.ReadPixels(
+		nil,
+		uint32(sdl.PIXELFORMAT_RGBA32),
+		unsafe.Pointer(&pixels[0]),
+		int(composition.Width*4),
+	); err != nil {
+		texture.Destroy()
+		return err
+	}
+	renderer.setGeneratedImage(composition.ID, texture, rect)
+	renderer.masks[composition.ID] = newAlphaMask(pixels, int(composition.Width*4), rect)
+	return nil
+}
+
+/*
+RemoveImageは、スプライト画像の登録を取り消します。実行時に作成した画像の場合はテクスチャも破棄します。
+取り消した画像を使うスプライトは書き出しの際にエラーとなるため、先に取り除いておく必要があります。
+*/
+func (renderer *Renderer) RemoveImage(id data.ImageIdentifier) {
+	si, ok := renderer.SpriteImages[id]
+	if !ok {
+		return
+	}
+	renderer.markImageDirty(id)
+	if si.Type == data.Generated {
+		si.SpriteTable.Destroy()
+	}
+	delete(renderer.SpriteImages, id)
+	delete(renderer.masks, id)
+}
+
+/*
+setGeneratedImageは、実行時に作成したテクスチャをスプライト画像として登録します。
+置き換える画像が実行時に作成したものであれば、そのテクスチャを破棄します。
+AddSpriteImagesで登録した画像であれば、その登録をテクスチャから外してから置き換えます。
+*/
+func (renderer *Renderer) setGeneratedImage(id data.ImageIdentifier, texture *sdl.Texture, rect data.Rect) {
+	renderer.assets.mtx.Lock()
+	renderer.forgetSheetImage(id)
+	renderer.assets.mtx.Unlock()
+	if old, ok := renderer.SpriteImages[id]; ok && old.Type == data.Generated {
+		old.SpriteTable.Destroy()
+	}
+	renderer.SpriteImages[id] = &data.SpriteImage{
+		SpriteTable: texture,
+		Rect:        rect,
+		Type:        data.Generated,
+	}
+	renderer.markImageDirty(id)
+}
+
+/*
+markImageDirtyは、スプライト画像を使っているスプライトを書き直しが必要な範囲に加えます。
+*/
+func (renderer *Renderer) markImageDirty(id data.ImageIdentifier) {
+	for _, layer := range renderer.Layers {
+		for _, sprite := range layer {
+			if sprite.Kind == data.KindImage && sprite.SrcImageID == id {
+				renderer.markSpriteDirty(sprite)
+			}
+		}
+	}
+}
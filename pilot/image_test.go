@@ -0,0 +1,107 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// newSurfaceRendererは、ウィンドウを使わずにサーフェスへ書き出す試験用のRendererを作成します
+func newSurfaceRenderer(t *testing.T) *Renderer {
+	surface, err := sdl.CreateRGBSurfaceWithFormat(0, 64, 64, 32, uint32(sdl.PIXELFORMAT_RGBA32))
+	if err != nil {
+		t.Skip(err)
+	}
+	sdlRenderer, err := sdl.CreateSoftwareRenderer(surface)
+	if err != nil {
+		surface.Free()
+		t.Skip(err)
+	}
+	t.Cleanup(func() {
+		sdlRenderer.Destroy()
+		surface.Free()
+	})
+	renderer := &Renderer{SdlRenderer: sdlRenderer}
+	renderer.initState()
+	return renderer
+}
+
+func TestPutImageRGBASize(t *testing.T) {
+	renderer := &Renderer{}
+	renderer.initState()
+	cases := []struct {
+		pixels        int
+		pitch         int
+		width, height int32
+	}{
+		{16, 8, 0, 2},
+		{16, 8, 2, 0},
+		{15, 8, 2, 2},
+		// 最後の行は一行のバイト数に満たなくてもよいが、画素の分は必要
+		{13, 8, 2, 2},
+		{40, 12, 3, 4},
+	}
+	for _, c := range cases {
+		if err := renderer.PutImageRGBA(1, make([]byte, c.pixels), c.pitch, c.width, c.height); err == nil {
+			t.Errorf("%d bytes for %dx%d (pitch %d) should be rejected", c.pixels, c.width, c.height, c.pitch)
+		}
+	}
+}
+
+func TestPutImageRGBAUpdate(t *testing.T) {
+	renderer := newSurfaceRenderer(t)
+	pixels := make([]byte, 4*4*4)
+	if err := renderer.PutImageRGBA(1, pixels, 16, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	texture := renderer.SpriteImages[1].SpriteTable
+	// 同じ大きさなら、テクスチャを作り直さずに内容と当たり判定を書き換える
+	pixels[3] = 255
+	if err := renderer.PutImageRGBA(1, pixels, 16, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	if renderer.SpriteImages[1].SpriteTable != texture {
+		t.Error("same size image should update the texture in place")
+	}
+	if !renderer.masks[1].at(0, 0) {
+		t.Error("mask should follow the new pixels")
+	}
+	// 大きさが変わればテクスチャを作り直す
+	if err := renderer.PutImageRGBA(1, make([]byte, 2*2*4), 8, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	si := renderer.SpriteImages[1]
+	if si.SpriteTable == texture || si.Rect != (data.Rect{Width: 2, Height: 2}) {
+		t.Errorf("resized image: %+v", si)
+	}
+}
+
+func TestPutImageRGBAOverSheet(t *testing.T) {
+	renderer := newSurfaceRenderer(t)
+	sheet, err := renderer.SdlRenderer.CreateTexture(uint32(sdl.PIXELFORMAT_RGBA32), sdl.TEXTUREACCESS_STATIC, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset := &textureAsset{
+		filename: "sheet.png",
+		texture:  sheet,
+		mask:     newAlphaMask(make([]byte, 4*4*4), 16, data.Rect{Width: 4, Height: 4}),
+		sheets:   make(map[data.ImageIdentifier]data.Rect),
+	}
+	renderer.assets.textures["sheet.png"] = asset
+	renderer.putSheetImage(asset, 1, data.Rect{Width: 2, Height: 2})
+	// AddSpriteImagesで登録したIDを置き換えると、スプライトシートの登録を外して使わなくなったテクスチャを解放する
+	if err := renderer.PutImageRGBA(1, make([]byte, 2*2*4), 8, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if renderer.assets.sheetTexture(1) != nil {
+		t.Error("sheet registration should be removed")
+	}
+	if _, ok := renderer.assets.textures["sheet.png"]; ok {
+		t.Error("unused sheet texture should be released")
+	}
+	if si := renderer.SpriteImages[1]; si.Type != data.Generated || si.SpriteTable == sheet {
+		t.Errorf("generated image: %+v", si)
+	}
+}
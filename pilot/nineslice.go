@@ -0,0 +1,145 @@
+package pilot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+/*
+slicePieceは、9分割画像を書き出す際の一回分の転送です。
+dstはスプライトの書き出し先の左上を原点とする座標です。
+*/
+type slicePiece struct {
+	src sdl.Rect
+	dst sdl.Rect
+}
+
+// sliceSpanは、9分割画像の一方向の区間です
+type sliceSpan struct {
+	src, srcLen int32
+	dst, dstLen int32
+}
+
+/*
+SetImageSliceは、登録済みのスプライト画像に9分割する際の枠の幅を設定します。
+*/
+func (renderer *Renderer) SetImageSlice(id data.ImageIdentifier, insets data.Insets) error {
+	si, ok := renderer.SpriteImages[id]
+	if !ok {
+		return errors.New(fmt.Sprintf("Unknown Sprite Image:%d", id))
+	}
+	si.Slice = insets
+	return nil
+}
+
+/*
+drawNineSliceは、スプライト画像を9分割してDistRectに合わせて書き出します。
+回転と裏返しはスプライト全体に対して行います。
+*/
+func (renderer *Renderer) drawNineSlice(sprite *data.Sprite, si *data.SpriteImage, dist sdl.Rect, point sdl.Point) error {
+	flip := sdlFlip(sprite.Flip)
+	pieces := nineSlicePieces(si.Rect, si.Slice, dist.W, dist.H, sprite.ScaleX, sprite.ScaleY, sprite.Slice == data.SliceTile)
+	for _, piece := range pieces {
+		dst := piece.dst
+		// 裏返す場合は、分割した位置もスプライトの中で反転する
+		if flip&sdl.FLIP_HORIZONTAL != 0 {
+			dst.X = dist.W - dst.X - dst.W
+		}
+		if flip&sdl.FLIP_VERTICAL != 0 {
+			dst.Y = dist.H - dst.Y - dst.H
+		}
+		// 全ての断片をスプライトの回転の中心で回転させる
+		center := sdl.Point{X: point.X - dst.X, Y: point.Y - dst.Y}
+		dst.X += dist.X
+		dst.Y += dist.Y
+		src := piece.src
+		renderer.countDraw(si.SpriteTable)
+		if err := renderer.SdlRenderer.CopyEx(si.SpriteTable, &src, &dst, sprite.Rotate.Angle, &center, flip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+nineSlicePiecesは、画像の矩形srcを枠の幅insetsで9分割し、w×hの大きさに書き出すための転送の一覧を返します。
+枠は拡大率に合わせて拡大し、書き出し先に収まらない場合は縮めます。
+tileがtrueなら、辺と中央を元の大きさ（拡大率を掛けた大きさ）で敷き詰めます。
+*/
+func nineSlicePieces(src data.Rect, insets data.Insets, w, h int32, scaleX, scaleY float64, tile bool) []slicePiece {
+	cols := sliceAxis(src.Left, src.Width, insets.Left, insets.Right, w, scaleX, tile)
+	rows := sliceAxis(src.Top, src.Height, insets.Top, insets.Bottom, h, scaleY, tile)
+	pieces := make([]slicePiece, 0, len(cols)*len(rows))
+	for _, row := range rows {
+		for _, col := range cols {
+			pieces = append(pieces, slicePiece{
+				src: sdl.Rect{X: col.src, Y: row.src, W: col.srcLen, H: row.srcLen},
+				dst: sdl.Rect{X: col.dst, Y: row.dst, W: col.dstLen, H: row.dstLen},
+			})
+		}
+	}
+	return pieces
+}
+
+/*
+sliceAxisは、一方向を始端の枠・中央・終端の枠に分け、書き出す区間の一覧を返します。
+*/
+func sliceAxis(start, length, head, tail, size int32, scale float64, tile bool) []sliceSpan {
+	head = clampInt32(head, 0, length)
+	tail = clampInt32(tail, 0, length-head)
+	dh, dt := float64(head)*scale, float64(tail)*scale
+	if dh+dt > float64(size) && dh+dt > 0 {
+		// 枠が書き出し先に収まらない場合は比率を保って縮める
+		f := float64(size) / (dh + dt)
+		dh, dt = dh*f, dt*f
+	}
+	d1 := int32(math.Round(dh))
+	d2 := size - int32(math.Round(dt))
+	var spans []sliceSpan
+	if head > 0 && d1 > 0 {
+		spans = append(spans, sliceSpan{src: start, srcLen: head, dst: 0, dstLen: d1})
+	}
+	if center := length - head - tail; center > 0 && d2 > d1 {
+		spans = append(spans, centerSpans(start+head, center, d1, d2-d1, scale, tile)...)
+	}
+	if tail > 0 && size > d2 {
+		spans = append(spans, sliceSpan{src: start + length - tail, srcLen: tail, dst: d2, dstLen: size - d2})
+	}
+	return spans
+}
+
+/*
+centerSpansは、中央の区間を引き伸ばす、または敷き詰める区間の一覧を返します。
+敷き詰める場合、最後の一枚は書き出し先からはみ出す分を切り取ります。
+*/
+func centerSpans(src, srcLen, dst, dstLen int32, scale float64, tile bool) []sliceSpan {
+	step := int32(math.Round(float64(srcLen) * scale))
+	if !tile || step <= 0 {
+		return []sliceSpan{{src: src, srcLen: srcLen, dst: dst, dstLen: dstLen}}
+	}
+	var spans []sliceSpan
+	for offset := int32(0); offset < dstLen; offset += step {
+		span := sliceSpan{src: src, srcLen: srcLen, dst: dst + offset, dstLen: step}
+		if rest := dstLen - offset; rest < step {
+			span.dstLen = rest
+			span.srcLen = clampInt32(int32(math.Round(float64(srcLen)*float64(rest)/float64(step))), 1, srcLen)
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// clampInt32は、値をlo〜hiの範囲に収めます
+func clampInt32(v, lo, hi int32) int32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
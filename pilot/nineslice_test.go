@@ -0,0 +1,44 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestNineSliceStretch(t *testing.T) {
+	src := data.Rect{Left: 10, Top: 20, Width: 30, Height: 30}
+	insets := data.Insets{Left: 8, Top: 8, Right: 8, Bottom: 8}
+	pieces := nineSlicePieces(src, insets, 100, 50, 1, 1, false)
+	if len(pieces) != 9 {
+		t.Fatalf("want 9 pieces, got %d", len(pieces))
+	}
+	center := pieces[4]
+	if center.src.X != 18 || center.src.Y != 28 || center.src.W != 14 || center.src.H != 14 {
+		t.Errorf("center src: %+v", center.src)
+	}
+	if center.dst.X != 8 || center.dst.Y != 8 || center.dst.W != 84 || center.dst.H != 34 {
+		t.Errorf("center dst: %+v", center.dst)
+	}
+	corner := pieces[8]
+	if corner.dst.X != 92 || corner.dst.Y != 42 || corner.dst.W != 8 || corner.dst.H != 8 {
+		t.Errorf("corner dst: %+v", corner.dst)
+	}
+}
+
+func TestNineSliceTile(t *testing.T) {
+	spans := sliceAxis(0, 30, 10, 10, 45, 1, true)
+	// 枠 + 中央10pxを2.5枚 + 枠
+	if len(spans) != 5 {
+		t.Fatalf("want 5 spans, got %d: %+v", len(spans), spans)
+	}
+	last := spans[3]
+	if last.dst != 30 || last.dstLen != 5 || last.srcLen != 5 {
+		t.Errorf("cropped tile: %+v", last)
+	}
+	// 枠が収まらない場合は縮める
+	spans = sliceAxis(0, 30, 10, 10, 10, 1, true)
+	if len(spans) != 2 || spans[0].dstLen != 5 || spans[1].dst != 5 {
+		t.Errorf("shrunk border: %+v", spans)
+	}
+}
@@ -17,12 +17,14 @@ Orchestraは、チャンネルから支持された音声ファイルを再生
 type Orchestra struct {
 	Sounds   map[data.SoundIdentifier]data.Sound
 	Channels []bool
+	watcher  *fileWatcher // 変更を検知する音声ファイル
 }
 
 /* Orchestraを初期化します */
 func NewOrchestra(effectChanel int) (*Orchestra, error) {
 	orchestra := Orchestra{}
 	orchestra.Sounds = make(map[data.SoundIdentifier]data.Sound)
+	orchestra.watcher = newFileWatcher()
 	if err := mix.Init(mix.INIT_OGG); err != nil {
 		return &Orchestra{}, err
 	}
@@ -51,6 +53,7 @@ func (orchestra *Orchestra) AddBGM(id data.SoundIdentifier, filename string) err
 		ID:       id,
 		PlayType: data.BGM,
 		Music:    m,
+		Filename: filename,
 	}
 	orchestra.Sounds[id] = s
 	return nil
@@ -69,6 +72,7 @@ func (orchestra *Orchestra) AddEffect(id data.SoundIdentifier, filename string)
 		ID:       id,
 		PlayType: data.EFFECT,
 		Effect:   e,
+		Filename: filename,
 	}
 	orchestra.Sounds[id] = s
 	return nil
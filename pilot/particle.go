@@ -0,0 +1,307 @@
+package pilot
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+/*
+particleは、放出された一つの粒子です。座標は画面上の位置で、発生源が動いても影響を受けません。
+*/
+type particle struct {
+	x, y     float64 // 中心の座標
+	vx, vy   float64 // 速度（ピクセル/秒）
+	angle    float64 // 回転角度
+	spin     float64 // 回転の速さ（度/秒）
+	age      float64 // 経過時間（ミリ秒）
+	life     float64 // 寿命（ミリ秒）
+	imageIdx int     // Emitter.ImageIDsの添字
+}
+
+/*
+emitterStateは、発生源ごとの粒子と放出の状態です。
+*/
+type emitterState struct {
+	particles []particle
+	running   bool     // 連続して放出しているか否か
+	pending   float64  // 放出しきれていない端数
+	bounds    sdl.Rect // 前のフレームで粒子が書き出された範囲
+}
+
+/*
+putEmitterは、発生源のスプライトが追加された際に状態を作成し、最初の放出を行います。
+登録済みの発生源が更新された場合は、粒子を引き継ぎます。
+*/
+func (renderer *Renderer) putEmitter(sprite *data.Sprite) {
+	if _, ok := renderer.emitters[sprite.Id]; ok {
+		return
+	}
+	state := emitterState{running: !sprite.Emitter.Stopped}
+	state.emit(sprite, sprite.Emitter.Burst)
+	renderer.emitters[sprite.Id] = &state
+}
+
+/*
+removeEmitterは、発生源の状態を削除します。
+粒子は発生源の範囲の外にも書き出されるため、前のフレームで粒子が書き出された範囲を書き直す範囲に加えます。
+*/
+func (renderer *Renderer) removeEmitter(sprite *data.Sprite) {
+	state, ok := renderer.emitters[sprite.Id]
+	if !ok {
+		return
+	}
+	if !state.bounds.Empty() {
+		renderer.dirtyRegion(sprite.LayerID).add(state.bounds)
+		renderer.LayerUpdated[sprite.LayerID] = true
+	}
+	delete(renderer.emitters, sprite.Id)
+}
+
+/*
+directEmitterは、発生源への指示（開始・停止・一度に放出）を反映します。
+*/
+func (renderer *Renderer) directEmitter(direction *data.Direction) {
+	state, ok := renderer.emitters[direction.SpriteID]
+	if !ok {
+		return
+	}
+	switch direction.Code {
+	case data.EmitterStart:
+		state.running = true
+	case data.EmitterStop:
+		state.running = false
+		state.pending = 0
+	case data.EmitterBurst:
+		if sprite, ok := renderer.findSprite(direction.SpriteID); ok {
+			state.emit(sprite, direction.Count)
+		}
+	}
+}
+
+/*
+UpdateParticlesは、前回の呼び出しからの経過時間（ミリ秒）だけ粒子を動かし、寿命の尽きた粒子を取り除きます。
+Pilotのフレームごとに呼び出されます。
+*/
+func (renderer *Renderer) UpdateParticles(delta uint32) {
+	dt := float64(delta) / 1000
+	for id, state := range renderer.emitters {
+		sprite, ok := renderer.findSprite(id)
+		if !ok {
+			delete(renderer.emitters, id)
+			continue
+		}
+		if sprite.Kind != data.KindEmitter {
+			// 発生源でなくなった場合は、残っていた粒子の範囲を書き直す
+			renderer.removeEmitter(sprite)
+			continue
+		}
+		emitter := &sprite.Emitter
+		alive := state.particles[:0]
+		for _, p := range state.particles {
+			p.age += float64(delta)
+			if p.age >= p.life {
+				continue
+			}
+			p.vx += emitter.GravityX * dt
+			p.vy += emitter.GravityY * dt
+			p.x += p.vx * dt
+			p.y += p.vy * dt
+			p.angle += p.spin * dt
+			alive = append(alive, p)
+		}
+		state.particles = alive
+		if state.running && emitter.Rate > 0 {
+			state.pending += emitter.Rate * dt
+			n := int(state.pending)
+			state.pending -= float64(n)
+			state.emit(sprite, n)
+		}
+		// 前のフレームと今のフレームで粒子のある範囲を書き直す
+		old := state.bounds
+		state.bounds = particleBounds(sprite, state.particles)
+		if !old.Empty() || !state.bounds.Empty() {
+			region := renderer.dirtyRegion(sprite.LayerID)
+			region.add(old)
+			region.add(state.bounds)
+			renderer.LayerUpdated[sprite.LayerID] = true
+		}
+	}
+}
+
+/*
+emitは、発生源の範囲内から粒子をn個放出します。
+*/
+func (state *emitterState) emit(sprite *data.Sprite, n int) {
+	emitter := &sprite.Emitter
+	rect := sprite.DistRect
+	left, top, _, _ := spriteOrigin(sprite)
+	for i := 0; i < n; i++ {
+		if emitter.MaxParticles > 0 && len(state.particles) >= emitter.MaxParticles {
+			return
+		}
+		speed := randomIn(emitter.Speed)
+		rad := randomIn(emitter.Direction) * math.Pi / 180
+		p := particle{
+			x:    left + rand.Float64()*float64(rect.Width),
+			y:    top + rand.Float64()*float64(rect.Height),
+			vx:   speed * math.Cos(rad),
+			vy:   speed * math.Sin(rad),
+			spin: randomIn(emitter.Spin),
+			life: math.Max(randomIn(emitter.Lifetime), 1),
+		}
+		if len(emitter.ImageIDs) > 0 {
+			p.imageIdx = rand.Intn(len(emitter.ImageIDs))
+		}
+		state.particles = append(state.particles, p)
+	}
+}
+
+/*
+drawParticlesは、発生源の粒子を書き出します。
+画像を使わない粒子は描画色と合成方法を変えて塗るため、書き出した後に元に戻します。
+*/
+func (renderer *Renderer) drawParticles(sprite *data.Sprite) error {
+	state, ok := renderer.emitters[sprite.Id]
+	if !ok {
+		return nil
+	}
+	defer renderer.keepDrawState()()
+	emitter := &sprite.Emitter
+	blend := sdlBlendMode(sprite.Blend)
+	for i := range state.particles {
+		p := &state.particles[i]
+		t := p.age / p.life
+		color := sampleColor(emitter.Color, t)
+		mod := sprite.ColorMod
+		r, g, b := mulColor(color.R, mod.R), mulColor(color.G, mod.G), mulColor(color.B, mod.B)
+		a := mulColor(mulColor(color.A, sprite.Alpha), uint8(255*clamp01(sampleValue(emitter.Alpha, t, 1))))
+		dist := particleRect(emitter, p, sampleValue(emitter.Scale, t, 1))
+		dist.X -= renderer.origin.X
+		dist.Y -= renderer.origin.Y
+		if len(emitter.ImageIDs) == 0 {
+			renderer.SdlRenderer.SetDrawBlendMode(blend)
+			renderer.SdlRenderer.SetDrawColor(r, g, b, a)
+			renderer.countDraw(nil)
+			if err := renderer.SdlRenderer.FillRect(&dist); err != nil {
+				return err
+			}
+			continue
+		}
+		si, ok := renderer.SpriteImages[emitter.ImageIDs[p.imageIdx]]
+		if !ok {
+			continue
+		}
+		si.SpriteTable.SetColorMod(r, g, b)
+		si.SpriteTable.SetAlphaMod(a)
+		si.SpriteTable.SetBlendMode(blend)
+		renderer.countDraw(si.SpriteTable)
+		if err := renderer.SdlRenderer.CopyEx(si.SpriteTable, si.Rect.ToSdlRect(), &dist, p.angle, nil, sdl.FLIP_NONE); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// particleRectは、粒子を書き出す矩形を返します
+func particleRect(emitter *data.Emitter, p *particle, scale float64) sdl.Rect {
+	w := float64(emitter.ParticleWidth) * scale
+	h := float64(emitter.ParticleHeight) * scale
+	return sdl.Rect{
+		X: int32(math.Round(p.x - w/2)),
+		Y: int32(math.Round(p.y - h/2)),
+		W: int32(math.Round(w)),
+		H: int32(math.Round(h)),
+	}
+}
+
+// particleBoundsは、全ての粒子を囲む矩形を返します（回転と拡大を考慮して余裕を持たせる）
+func particleBounds(sprite *data.Sprite, particles []particle) sdl.Rect {
+	var bounds sdl.Rect
+	maxScale := 1.0
+	for _, key := range sprite.Emitter.Scale {
+		maxScale = math.Max(maxScale, key.Value)
+	}
+	for i := range particles {
+		r := particleRect(&sprite.Emitter, &particles[i], maxScale*math.Sqrt2)
+		r = sdl.Rect{X: r.X - 1, Y: r.Y - 1, W: r.W + 2, H: r.H + 2}
+		if bounds.Empty() {
+			bounds = r
+		} else {
+			bounds = bounds.Union(&r)
+		}
+	}
+	return bounds
+}
+
+// randomInは、範囲内のランダムな値を返します
+func randomIn(r data.Range) float64 {
+	return r.Min + rand.Float64()*(r.Max-r.Min)
+}
+
+// clamp01は、値を0〜1の範囲に収めます
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+/*
+sampleValueは、寿命の割合tにおける値を基準点から補間して返します。基準点がなければdefを返します。
+*/
+func sampleValue(keys []data.ValueKey, t float64, def float64) float64 {
+	if len(keys) == 0 {
+		return def
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Time > t })
+	if i == 0 {
+		return keys[0].Value
+	}
+	if i == len(keys) {
+		return keys[len(keys)-1].Value
+	}
+	a, b := keys[i-1], keys[i]
+	p := ease(a.Easing, (t-a.Time)/(b.Time-a.Time))
+	return a.Value + (b.Value-a.Value)*p
+}
+
+/*
+sampleColorは、寿命の割合tにおける色を基準点から補間して返します。基準点がなければ白を返します。
+*/
+func sampleColor(keys []data.ColorKey, t float64) data.Color {
+	if len(keys) == 0 {
+		return data.Color{R: 255, G: 255, B: 255, A: 255}
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Time > t })
+	if i == 0 {
+		return keys[0].Color
+	}
+	if i == len(keys) {
+		return keys[len(keys)-1].Color
+	}
+	a, b := keys[i-1], keys[i]
+	p := ease(a.Easing, (t-a.Time)/(b.Time-a.Time))
+	lerp := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*clamp01(p)))
+	}
+	return data.Color{
+		R: lerp(a.Color.R, b.Color.R),
+		G: lerp(a.Color.G, b.Color.G),
+		B: lerp(a.Color.B, b.Color.B),
+		A: lerp(a.Color.A, b.Color.A),
+	}
+}
+
+/*
+keepDrawStateは、現在の描画色と合成方法を保存し、それらを元に戻す関数を返します。
+*/
+func (renderer *Renderer) keepDrawState() func() {
+	var blend sdl.BlendMode
+	renderer.SdlRenderer.GetDrawBlendMode(&blend)
+	r, g, b, a, _ := renderer.SdlRenderer.GetDrawColor()
+	return func() {
+		renderer.SdlRenderer.SetDrawBlendMode(blend)
+		renderer.SdlRenderer.SetDrawColor(r, g, b, a)
+	}
+}
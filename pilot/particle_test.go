@@ -0,0 +1,109 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// newEmitterRendererは、レイヤー0に発生源のスプライトを一つ置いた試験用のRendererを作成します
+func newEmitterRenderer(emitter data.Emitter) (*Renderer, *data.Sprite) {
+	renderer := &Renderer{}
+	renderer.initState()
+	renderer.Layers[0] = make(map[data.SpriteIdentifier]*data.Sprite)
+	renderer.layerIndex[0] = newSpatialIndex()
+	sprite := data.NewSprite(0)
+	sprite.Kind = data.KindEmitter
+	sprite.DistRect = data.Rect{Left: 100, Top: 100, Width: 10, Height: 10}
+	sprite.Emitter = emitter
+	renderer.AddSpriteForLayer(&sprite)
+	put, _ := renderer.findSprite(sprite.Id)
+	return renderer, put
+}
+
+func TestParticleRate(t *testing.T) {
+	renderer, sprite := newEmitterRenderer(data.Emitter{
+		ParticleWidth:  2,
+		ParticleHeight: 2,
+		Rate:           10,
+		Lifetime:       data.Range{Min: 5000, Max: 5000},
+	})
+	// 1秒に10個の割合で、端数を持ち越して放出する
+	for i := 0; i < 4; i++ {
+		renderer.UpdateParticles(250)
+	}
+	state := renderer.emitters[sprite.Id]
+	if len(state.particles) != 10 {
+		t.Errorf("particles after 1s: %d", len(state.particles))
+	}
+	// 停止すると放出しない
+	renderer.applyDirection(&data.Direction{Code: data.EmitterStop, SpriteID: sprite.Id})
+	renderer.UpdateParticles(1000)
+	if len(state.particles) != 10 {
+		t.Errorf("stopped emitter emitted: %d", len(state.particles))
+	}
+	// 上限を超えて放出しない
+	sprite.Emitter.MaxParticles = 12
+	renderer.applyDirection(&data.Direction{Code: data.EmitterBurst, SpriteID: sprite.Id, Count: 5})
+	if len(state.particles) != 12 {
+		t.Errorf("burst over the limit: %d", len(state.particles))
+	}
+}
+
+func TestParticleLifetime(t *testing.T) {
+	renderer, sprite := newEmitterRenderer(data.Emitter{
+		ParticleWidth:  2,
+		ParticleHeight: 2,
+		Burst:          5,
+		Lifetime:       data.Range{Min: 100, Max: 100},
+		Speed:          data.Range{Min: 100, Max: 100},
+	})
+	state := renderer.emitters[sprite.Id]
+	renderer.UpdateParticles(50)
+	if len(state.particles) != 5 || state.bounds.Empty() {
+		t.Fatalf("particles %d bounds %+v", len(state.particles), state.bounds)
+	}
+	// 寿命の尽きた粒子を取り除き、粒子のあった範囲を書き直す
+	old := state.bounds
+	renderer.layerDirty[0] = &dirtyRegion{}
+	renderer.UpdateParticles(50)
+	if len(state.particles) != 0 || !state.bounds.Empty() {
+		t.Errorf("expired: particles %d bounds %+v", len(state.particles), state.bounds)
+	}
+	if !coveredBy(old, renderer.layerDirty[0].rects) {
+		t.Errorf("old bounds %+v not dirty: %v", old, renderer.layerDirty[0].rects)
+	}
+}
+
+func TestRemoveEmitterMarksDirty(t *testing.T) {
+	renderer, sprite := newEmitterRenderer(data.Emitter{
+		ParticleWidth:  4,
+		ParticleHeight: 4,
+		Burst:          3,
+		Lifetime:       data.Range{Min: 1000, Max: 1000},
+		Speed:          data.Range{Min: 400, Max: 400},
+	})
+	renderer.UpdateParticles(100)
+	bounds := renderer.emitters[sprite.Id].bounds
+	renderer.layerDirty[0] = &dirtyRegion{}
+	renderer.LayerUpdated[0] = false
+	// 発生源の外に飛んだ粒子の範囲も書き直す
+	renderer.RemoveSprite(sprite.Id)
+	if _, ok := renderer.emitters[sprite.Id]; ok {
+		t.Error("emitter state should be removed")
+	}
+	if !renderer.LayerUpdated[0] || !coveredBy(bounds, renderer.layerDirty[0].rects) {
+		t.Errorf("bounds %+v not dirty: %v", bounds, renderer.layerDirty[0].rects)
+	}
+}
+
+// coveredByは、矩形がいずれかの矩形に含まれるか否かを返します
+func coveredBy(rect sdl.Rect, rects []sdl.Rect) bool {
+	for _, r := range rects {
+		if u := r.Union(&rect); u == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+)
+
+// ボタンを押してからドラッグとみなすまでの移動量（論理解像度のピクセル）
+const dragThreshold = 4
+
+/*
+pointerStateは、スプライトに対するカーソルの状態です。
+*/
+type pointerState struct {
+	hover    data.SpriteIdentifier // カーソルの下にあるスプライト
+	pressed  data.SpriteIdentifier // ボタンを押した時のスプライト
+	button   data.MouseButton      // 押しているボタン
+	downX    int32                 // ボタンを押した座標
+	downY    int32
+	dragging bool  // ドラッグ中か否か
+	x, y     int32 // 最後に受け取ったカーソルの座標
+}
+
+/*
+PickSpriteは、ウィンドウ上の座標にある一番上のスプライトを返します。
+表示中のレイヤーのうち、Pickableが設定された表示中のスプライトのみが対象です。
+画面描画と同じスレッドから呼び出す必要があります。
+*/
+func (renderer *Renderer) PickSprite(windowX, windowY int32) (data.SpriteIdentifier, bool) {
+	x, y := renderer.WindowToLogical(windowX, windowY)
+	return renderer.pickSprite(x, y)
+}
+
+/*
+pickSpriteは、論理解像度の座標にある一番上のスプライトを返します。
+ビューポートを設定している場合は、座標を含む一番上のビューポートのカメラの座標に変換して調べます。
+そのビューポートがカーソルの当たり判定の対象でなければ、スプライトは選びません。
+*/
+func (renderer *Renderer) pickSprite(x, y int32) (data.SpriteIdentifier, bool) {
+	// ピクセルの中心で判定する
+	px, py := float64(x)+0.5, float64(y)+0.5
+	if len(renderer.viewports) == 0 {
+		return renderer.pickLayers(px, py, nil)
+	}
+	ids := renderer.viewportIDs()
+	for i := len(ids) - 1; i >= 0; i-- {
+		viewport := &renderer.viewports[ids[i]].viewport
+		cx, cy, ok := viewport.ToCamera(px, py)
+		if !ok {
+			continue
+		}
+		if !viewport.Pickable {
+			break
+		}
+		return renderer.pickLayers(cx, cy, viewport)
+	}
+	return data.SpriteIdentifier{}, false
+}
+
+/*
+pickLayersは、スプライトの座標にある一番上のスプライトを返します。
+上のレイヤーから順に調べ、同じレイヤーの中では上に書き出されるものを選びます。
+viewportを指定した場合は、そのビューポートが書き出すレイヤーだけを調べ、レイヤーのClipは使いません。
+*/
+func (renderer *Renderer) pickLayers(px, py float64, viewport *data.Viewport) (data.SpriteIdentifier, bool) {
+	ids := renderer.getLayerIDs()
+	for i := len(ids) - 1; i >= 0; i-- {
+		property := renderer.layerProperties[ids[i]]
+		if property.Hidden || property.Alpha == 0 {
+			continue
+		}
+		if viewport != nil {
+			if !viewport.Contains(ids[i]) {
+				continue
+			}
+		} else if clip := property.Clip; clip.Width > 0 && clip.Height > 0 &&
+			(px < float64(clip.Left) || py < float64(clip.Top) ||
+				px >= float64(clip.Left+clip.Width) || py >= float64(clip.Top+clip.Height)) {
+			continue
+		}
+		var found *data.Sprite
+		for _, sprite := range renderer.Layers[ids[i]] {
+			if !sprite.Pickable || sprite.Hidden || sprite.Kind == data.KindEmitter {
+				continue
+			}
+			if found != nil && !drawsBefore(found, sprite, property.Sort) {
+				continue
+			}
+			if spriteContains(sprite, px, py) {
+				found = sprite
+			}
+		}
+		if found != nil {
+			return found.Id, true
+		}
+	}
+	return data.SpriteIdentifier{}, false
+}
+
+/*
+spriteLocalPointは、論理解像度の座標を、拡大・回転・裏返しを戻したスプライトの座標
+（DistRectの左上を原点とする座標）に変換します。transformPointの逆変換です。
+*/
+func spriteLocalPoint(sprite *data.Sprite, x, y float64) (float64, float64, bool) {
+	if sprite.ScaleX == 0 || sprite.ScaleY == 0 {
+		return 0, 0, false
+	}
+	left, top, cx, cy := spriteOrigin(sprite)
+	x -= left + cx
+	y -= top + cy
+	if sprite.Rotate.Angle != 0 {
+		rad := -sprite.Rotate.Angle * math.Pi / 180
+		sin, cos := math.Sin(rad), math.Cos(rad)
+		x, y = x*cos-y*sin, x*sin+y*cos
+	}
+	x = x/sprite.ScaleX + cx
+	y = y/sprite.ScaleY + cy
+	if sprite.Flip&data.Horizontal != 0 {
+		x = float64(sprite.DistRect.Width) - x
+	}
+	if sprite.Flip&data.Vertical != 0 {
+		y = float64(sprite.DistRect.Height) - y
+	}
+	return x, y, true
+}
+
+/*
+spriteContainsは、論理解像度の座標がスプライトの内側にあるか否かを返します。
+円の図形は楕円として、それ以外はDistRectの矩形として判定します。
+*/
+func spriteContains(sprite *data.Sprite, x, y float64) bool {
+	lx, ly, ok := spriteLocalPoint(sprite, x, y)
+	if !ok {
+		return false
+	}
+	w, h := float64(sprite.DistRect.Width), float64(sprite.DistRect.Height)
+	if lx < 0 || ly < 0 || lx >= w || ly >= h {
+		return false
+	}
+	if sprite.Kind == data.KindShape && sprite.Shape.Type == data.ShapeCircle {
+		dx, dy := (lx-w/2)/(w/2), (ly-h/2)/(h/2)
+		return dx*dx+dy*dy <= 1
+	}
+	return true
+}
+
+/*
+pointerEventsは、論理解像度に変換済みのマウスのイベントから、スプライトに対するイベントを作成します。
+*/
+func (renderer *Renderer) pointerEvents(evt data.Event) []data.Event {
+	if evt.Device != data.DeviceMouse || evt.Code == data.MouseWheelUp || evt.Code == data.MouseWheelDown {
+		return nil
+	}
+	state := &renderer.pointer
+	x, y := evt.Mouse.X, evt.Mouse.Y
+	state.x, state.y = x, y
+	target, _ := renderer.pickSprite(x, y)
+	var events []data.Event
+	emit := func(code data.EventCode, id data.SpriteIdentifier, button data.MouseButton) {
+		events = append(events, data.Event{
+			Device: data.DeviceMouse,
+			Code:   code,
+			Mouse:  data.Mouse{X: x, Y: y, Sprite: id, Button: button},
+		})
+	}
+	none := data.SpriteIdentifier{}
+
+	if target != state.hover {
+		if state.hover != none {
+			emit(data.SpriteLeave, state.hover, data.MouseButtonNone)
+		}
+		if target != none {
+			emit(data.SpriteEnter, target, data.MouseButtonNone)
+		}
+		state.hover = target
+	}
+
+	switch evt.Code {
+	case data.MouseLeftDown, data.MouseRightDown:
+		state.button = data.MouseButtonLeft
+		if evt.Code == data.MouseRightDown {
+			state.button = data.MouseButtonRight
+		}
+		state.pressed = target
+		state.downX, state.downY = x, y
+		state.dragging = false
+		if target != none {
+			emit(data.SpriteDown, target, state.button)
+		}
+	case data.MouseLeftDragging, data.MouseRightDragging:
+		if state.pressed != none && !state.dragging &&
+			(abs32(x-state.downX) > dragThreshold || abs32(y-state.downY) > dragThreshold) {
+			state.dragging = true
+			emit(data.SpriteDragStart, state.pressed, state.button)
+		}
+	case data.MouseLeftUp, data.MouseLeftDrop, data.MouseRightUp, data.MouseRightDrop:
+		if target != none {
+			emit(data.SpriteUp, target, state.button)
+		}
+		if state.dragging {
+			emit(data.SpriteDragEnd, state.pressed, state.button)
+		} else if state.pressed != none && state.pressed == target {
+			emit(data.SpriteClick, target, state.button)
+		}
+		state.pressed = none
+		state.button = data.MouseButtonNone
+		state.dragging = false
+	}
+	return events
+}
+
+// abs32は、絶対値を返します
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
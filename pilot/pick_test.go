@@ -0,0 +1,36 @@
+package pilot
+
+import (
+	"math"
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestSpriteContainsRotated(t *testing.T) {
+	sprite := data.NewSprite(0)
+	sprite.DistRect = data.Rect{Left: 0, Top: 0, Width: 100, Height: 20}
+	sprite.Rotate = data.Rotate{CenterX: 50, CenterY: 10, Angle: 90}
+	// 90度回転すると縦長になる
+	if !spriteContains(&sprite, 50.5, -29.5) {
+		t.Error("rotated top should be inside")
+	}
+	if spriteContains(&sprite, 90.5, 10.5) {
+		t.Error("original right end should be outside")
+	}
+}
+
+func TestSpriteLocalPointInverse(t *testing.T) {
+	sprite := data.NewSprite(0)
+	sprite.DistRect = data.Rect{Left: 30, Top: 40, Width: 64, Height: 32}
+	sprite.Rotate = data.Rotate{CenterX: 10, CenterY: 5, Angle: 33}
+	sprite.ScaleX, sprite.ScaleY = 1.5, 0.5
+	sprite.Flip = data.Horizontal | data.Vertical
+	for _, p := range []fpoint{{0, 0}, {64, 0}, {12.5, 30}, {63, 31}} {
+		q := transformPoint(&sprite, p)
+		x, y, ok := spriteLocalPoint(&sprite, q.x, q.y)
+		if !ok || math.Abs(x-p.x) > 1e-9 || math.Abs(y-p.y) > 1e-9 {
+			t.Errorf("%v -> %v -> (%v, %v)", p, q, x, y)
+		}
+	}
+}
@@ -21,6 +21,7 @@ package pilot
 
 import (
 	"sync"
+	"time"
 
 	"github.com/collabologic/theater/data"
 	"github.com/veandco/go-sdl2/sdl"
@@ -37,6 +38,14 @@ type Pilot struct {
 	*Orchestra
 	running    bool // 処理中か否か
 	mtxRunning sync.Mutex
+	clock      frameClock // フレームの間隔と更新のタイミング
+	// 画面を保存するホットキーと保存先のディレクトリ
+	screenshotKey data.Scancode
+	screenshotDir string
+	// デバッグ表示を切り替えるホットキー
+	debugKey data.Scancode
+	// 画像と音声のファイルの変更を調べる間隔（0なら調べない）
+	reloadInterval time.Duration
 }
 
 /*
@@ -63,14 +72,14 @@ RunはPilotを稼働させます。
 
 具体的には、controler, renderer, orchestraを生成し、それぞれの送受信ループをgoroutinとして走らせます。
 */
-func (pilot *Pilot) Run(eventCh chan<- data.Event, spriteCh <-chan data.Sprite, soundCh <-chan data.Conduct) error {
+func (pilot *Pilot) Run(eventCh chan<- data.Event, directionCh <-chan data.Direction, soundCh <-chan data.Conduct) error {
 
-	// スプライトの受信ループ
-	go func(ch <-chan data.Sprite) {
-		for sprt := range ch {
-			pilot.Renderer.AddSpriteForLayer(sprt)
+	// 描画の指示の受信ループ
+	go func(ch <-chan data.Direction) {
+		for drct := range ch {
+			pilot.Renderer.Direct(drct)
 		}
-	}(spriteCh)
+	}(directionCh)
 
 	// 画面描画ループ
 	/*go func() {
@@ -88,8 +97,23 @@ func (pilot *Pilot) Run(eventCh chan<- data.Event, spriteCh <-chan data.Sprite,
 
 	// 音声の受信ループ
 	go func(ch <-chan data.Conduct) {
-		for cndct := range ch {
-			pilot.Orchestra.Play(cndct)
+		// 音声ファイルの変更も同じgoroutineで調べる
+		var poll <-chan time.Time
+		if pilot.reloadInterval > 0 {
+			ticker := time.NewTicker(pilot.reloadInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+		for {
+			select {
+			case cndct, ok := <-ch:
+				if !ok {
+					return
+				}
+				pilot.Orchestra.Play(cndct)
+			case <-poll:
+				pilot.Orchestra.reloadChanged()
+			}
 		}
 	}(soundCh)
 	// 入力イベントの送信ループ
@@ -99,6 +123,9 @@ func (pilot *Pilot) Run(eventCh chan<- data.Event, spriteCh <-chan data.Sprite,
 		pilot.mtxRunning.Lock()
 		pilot.running = true
 		pilot.mtxRunning.Unlock()
+		pilot.clock.start(time.Now())
+		var ticks tickQueue
+		var events eventQueue
 		for pilot.running {
 			sdl.Do(func() {
 				if !pilot.running {
@@ -109,21 +136,75 @@ func (pilot *Pilot) Run(eventCh chan<- data.Event, spriteCh <-chan data.Sprite,
 				if err != nil {
 					panic(err)
 				}
+				if err := pilot.Renderer.ApplyDirections(); err != nil {
+					panic(err)
+				}
+				if pilot.Renderer.DebugOverlay() {
+					pilot.Renderer.setDebugInfo(pilot.FrameStats(), pilot.clock.recent(), debugBacklog{
+						directions: len(directionCh),
+						sounds:     len(soundCh),
+						events:     len(evtch) + len(events.pending),
+					})
+				}
+				for _, tick := range pilot.clock.advance(time.Now()) {
+					pilot.Renderer.Update(tick.Delta)
+					ticks.add(tick)
+				}
+				// 前のフレームで送れなかったイベントを先に送る
+				events.flush(evtch)
+				ticks.flush(evtch)
 				if err := pilot.Renderer.DrawLayers(); err != nil {
 					panic(err)
 				}
+				events.push(pilot.Renderer.TakeEvents()...)
 				if !running {
 					pilot.mtxRunning.Lock()
 					pilot.running = false
 					pilot.mtxRunning.Unlock()
+				} else if pilot.isHotKey(res, pilot.debugKey) {
+					pilot.Renderer.SetDebugOverlay(!pilot.Renderer.DebugOverlay())
+				} else if pilot.isHotKey(res, pilot.screenshotKey) {
+					pilot.Renderer.SaveScreenshot(screenshotName(pilot.screenshotDir, time.Now()))
 				} else if res.Code != data.NoEvent {
-					evtch <- res
+					if res.Device == data.DeviceMouse && res.Code != data.MouseWheelUp && res.Code != data.MouseWheelDown {
+						pilot.Renderer.mouseToLogical(&res.Mouse)
+					}
+					events.push(res)
+					events.push(pilot.Renderer.pointerEvents(res)...)
 				}
+				events.flush(evtch)
 
 			})
+			// フレーム数の上限に合わせて待機する
+			pilot.clock.wait()
 		}
 
 	}(eventCh)
 
 	return nil
 }
+
+/*
+SetScreenshotKeyは、押すと画面をdirにPNGで保存するキーを設定します。Runの前に呼び出します。
+設定したキーの入力はAppへ送信しません。data.K_UNKNOWNを指定すると無効にします。
+*/
+func (pilot *Pilot) SetScreenshotKey(key data.Scancode, dir string) {
+	pilot.screenshotKey = key
+	pilot.screenshotDir = dir
+}
+
+/*
+SetDebugKeyは、押すとデバッグ表示を切り替えるキーを設定します。Runの前に呼び出します。
+設定したキーの入力はAppへ送信しません。data.K_UNKNOWNを指定すると無効にします。
+*/
+func (pilot *Pilot) SetDebugKey(key data.Scancode) {
+	pilot.debugKey = key
+}
+
+// isHotKeyは、入力がホットキーを押したものか否かを返します
+func (pilot *Pilot) isHotKey(evt data.Event, key data.Scancode) bool {
+	return key != data.Scancode(data.K_UNKNOWN) &&
+		evt.Device == data.DeviceKeyboard &&
+		evt.Code == data.KeyPressOn &&
+		evt.Keyboard.Keycode == key
+}
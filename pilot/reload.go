@@ -0,0 +1,211 @@
+package pilot
+
+import (
+	"os"
+	"time"
+
+	"github.com/collabologic/theater/data"
+	mix "github.com/veandco/go-sdl2/mix"
+)
+
+/*
+fileStampは、ファイルの変更を検知するための更新日時と大きさです。
+*/
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+/*
+fileWatcherは、ファイルの更新日時と大きさを定期的に調べて変更を検知します。
+*/
+type fileWatcher struct {
+	stamps map[string]fileStamp
+}
+
+// newFileWatcherは、空のfileWatcherを作成します
+func newFileWatcher() *fileWatcher {
+	return &fileWatcher{stamps: make(map[string]fileStamp)}
+}
+
+/*
+changedは、前回調べた時から変更されたファイルを返します。
+初めて調べるファイルは記録するだけで、変更とはみなしません。
+読み取れないファイル（書き込み中や削除されたもの）は前回の記録を残し、次に読み取れた時に改めて比べます。
+*/
+func (watcher *fileWatcher) changed(filenames []string) []string {
+	var changed []string
+	watched := make(map[string]bool, len(filenames))
+	for _, filename := range filenames {
+		watched[filename] = true
+		info, err := os.Stat(filename)
+		if err != nil {
+			continue
+		}
+		stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+		old, ok := watcher.stamps[filename]
+		watcher.stamps[filename] = stamp
+		if ok && old != stamp {
+			changed = append(changed, filename)
+		}
+	}
+	for filename := range watcher.stamps {
+		if !watched[filename] {
+			delete(watcher.stamps, filename)
+		}
+	}
+	return changed
+}
+
+/*
+retryは、読み込み直しに失敗したファイルを、次に調べた時にも変更されたものとみなすようにします。
+*/
+func (watcher *fileWatcher) retry(filename string) {
+	if _, ok := watcher.stamps[filename]; ok {
+		watcher.stamps[filename] = fileStamp{}
+	}
+}
+
+/*
+hotReloadは、読み込んだ画像ファイルの変更を調べる間隔と経過時間です。
+*/
+type hotReload struct {
+	watcher  *fileWatcher
+	interval uint32 // 調べる間隔（ミリ秒）
+	elapsed  uint32 // 前回調べてからの経過時間（ミリ秒）
+}
+
+/*
+SetHotReloadは、読み込んだ画像ファイルの変更をintervalごとに調べ、変更されたものを読み込み直すようにします。
+0を指定すると無効にします。画面描画と同じスレッドから呼び出す必要があります。
+*/
+func (renderer *Renderer) SetHotReload(interval time.Duration) {
+	if interval <= 0 {
+		renderer.reload = nil
+		return
+	}
+	ms := uint32(interval.Milliseconds())
+	if ms == 0 {
+		ms = 1
+	}
+	renderer.reload = &hotReload{watcher: newFileWatcher(), interval: ms}
+}
+
+/*
+updateHotReloadは、経過時間を進め、間隔が経過していれば画像ファイルの変更を調べて読み込み直します。
+読み込みに失敗したファイルは、次に調べた時に改めて読み込みます。
+*/
+func (renderer *Renderer) updateHotReload(delta uint32) {
+	reload := renderer.reload
+	if reload == nil {
+		return
+	}
+	reload.elapsed += delta
+	if reload.elapsed < reload.interval {
+		return
+	}
+	reload.elapsed = 0
+	renderer.assets.mtx.Lock()
+	filenames := make([]string, 0, len(renderer.assets.textures))
+	for filename := range renderer.assets.textures {
+		filenames = append(filenames, filename)
+	}
+	renderer.assets.mtx.Unlock()
+	for _, filename := range reload.watcher.changed(filenames) {
+		if err := renderer.ReloadImageFile(filename); err != nil {
+			reload.watcher.retry(filename)
+		}
+	}
+}
+
+/*
+ReloadImageFileは、読み込み済みの画像ファイルを読み込み直し、そのファイルを使うスプライト画像のテクスチャを置き換えます。
+スプライト画像のIDと矩形は変わりません。読み込んでいないファイルの場合は何もしません。
+*/
+func (renderer *Renderer) ReloadImageFile(filename string) error {
+	manager := renderer.assets
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+	texture, ok := manager.textures[assetKey(filename)]
+	if !ok {
+		return nil
+	}
+	loaded, err := renderer.readTexture(filename)
+	if err != nil {
+		return err
+	}
+	for id, si := range renderer.SpriteImages {
+		if si.SpriteTable == texture.texture {
+			si.SpriteTable = loaded.texture
+			renderer.masks[id] = loaded.mask.sub(si.Rect)
+			renderer.markImageDirty(id)
+		}
+	}
+	texture.texture.Destroy()
+	manager.bytes += loaded.bytes - texture.bytes
+	texture.texture = loaded.texture
+	texture.mask = loaded.mask
+	texture.width = loaded.width
+	texture.height = loaded.height
+	texture.bytes = loaded.bytes
+	renderer.enforceBudget()
+	return nil
+}
+
+/*
+ReloadSoundFileは、音声ファイルを読み込み直し、そのファイルを使う音声を置き換えます。IDは変わりません。
+置き換えた音声が再生中の場合、再生は止まります。音声を再生するgoroutineから呼び出す必要があります。
+*/
+func (orchestra *Orchestra) ReloadSoundFile(filename string) error {
+	for id, s := range orchestra.Sounds {
+		if s.Filename != filename {
+			continue
+		}
+		switch s.PlayType {
+		case data.BGM:
+			m, err := mix.LoadMUS(filename)
+			if err != nil {
+				return err
+			}
+			s.Music.Free()
+			s.Music = m
+		case data.EFFECT:
+			e, err := mix.LoadWAV(filename)
+			if err != nil {
+				return err
+			}
+			s.Effect.Free()
+			s.Effect = e
+		}
+		orchestra.Sounds[id] = s
+	}
+	return nil
+}
+
+/*
+reloadChangedは、音声ファイルの変更を調べ、変更されたものを読み込み直します。
+*/
+func (orchestra *Orchestra) reloadChanged() {
+	var filenames []string
+	seen := make(map[string]bool)
+	for _, s := range orchestra.Sounds {
+		if s.Filename != "" && !seen[s.Filename] {
+			seen[s.Filename] = true
+			filenames = append(filenames, s.Filename)
+		}
+	}
+	for _, filename := range orchestra.watcher.changed(filenames) {
+		if err := orchestra.ReloadSoundFile(filename); err != nil {
+			orchestra.watcher.retry(filename)
+		}
+	}
+}
+
+/*
+SetHotReloadは、読み込んだ画像と音声のファイルの変更をintervalごとに調べ、
+変更されたものをIDを変えずに読み込み直すようにします。Runの前に呼び出します。0を指定すると無効にします。
+*/
+func (pilot *Pilot) SetHotReload(interval time.Duration) {
+	pilot.reloadInterval = interval
+	pilot.Renderer.SetHotReload(interval)
+}
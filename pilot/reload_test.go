@@ -0,0 +1,44 @@
+package pilot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatcherChanged(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sprite.png")
+	if err := os.WriteFile(filename, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	watcher := newFileWatcher()
+	// 初めて調べたファイルは変更とみなさない
+	if got := watcher.changed([]string{filename}); len(got) != 0 {
+		t.Errorf("first poll reported %v", got)
+	}
+	if got := watcher.changed([]string{filename}); len(got) != 0 {
+		t.Errorf("unchanged file reported %v", got)
+	}
+	if err := os.WriteFile(filename, []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := watcher.changed([]string{filename}); len(got) != 1 || got[0] != filename {
+		t.Errorf("changed file not reported: %v", got)
+	}
+	// 読み込み直しに失敗したファイルは次も変更とみなす
+	watcher.retry(filename)
+	if got := watcher.changed([]string{filename}); len(got) != 1 {
+		t.Errorf("retried file not reported: %v", got)
+	}
+	// 削除されたファイルは記録を残して報告しない
+	os.Remove(filename)
+	if got := watcher.changed([]string{filename}); len(got) != 0 {
+		t.Errorf("missing file reported %v", got)
+	}
+}
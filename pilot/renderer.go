@@ -1,11 +1,12 @@
 package pilot
 
 import (
+	"bytes"
 	"errors"
 	"sort"
+	"sync"
 
 	"github.com/collabologic/theater/data"
-	"github.com/veandco/go-sdl2/img"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -19,17 +20,74 @@ type Renderer struct {
 	LayerTextures map[data.LayerIdentifier]*sdl.Texture
 	// レイヤーの更新フラグ
 	LayerUpdated map[data.LayerIdentifier]bool
+	// レイヤーの表示の設定
+	layerProperties map[data.LayerIdentifier]data.LayerProperty
+	// レイヤーごとのスプライトの空間インデックス
+	layerIndex map[data.LayerIdentifier]*spatialIndex
+	// レイヤーの中で書き直しが必要な範囲
+	layerDirty map[data.LayerIdentifier]*dirtyRegion
+	// 画面の一部にレイヤーを書き出すビューポート
+	viewports map[data.ViewportIdentifier]*viewportState
+	// 書き出し先の左上に対応するスプライトの座標（ビューポートのカメラの左上）
+	origin sdl.Point
 	// スプライトイメージ（個別の画像）
 	SpriteImages map[data.ImageIdentifier]*data.SpriteImage
+	// スプライトイメージごとの当たり判定用の画像
+	masks map[data.ImageIdentifier]*alphaMask
+	// 読み込んだ画像ファイルと名前を付けたスプライトイメージ
+	assets *assetManager
 	// ウィンドウ
 	Window *sdl.Window
 	// ウィンドウに対するSDLレンダラー
 	SdlRenderer *sdl.Renderer
+	// フォント
+	fonts map[data.FontIdentifier]textFont
+	// スプライトごとの実行中のTween
+	tweens map[data.SpriteIdentifier]*tweenEntry
+	// パーティクルの発生源ごとの状態
+	emitters map[data.SpriteIdentifier]*emitterState
+	// スプライトが登録されているレイヤー
+	spriteLayers map[data.SpriteIdentifier]data.LayerIdentifier
+	// 親を持つスプライトの、親を基準とした値（Layersには画面上の値を求めたものを登録する）
+	locals map[data.SpriteIdentifier]*data.Sprite
+	// 論理解像度と、ウィンドウへの拡大方法
+	logicalW    int32
+	logicalH    int32
+	scalePolicy ScalePolicy
+	scaleFilter ScaleFilter
+	letterbox   data.Color
+	// 全てのレイヤーを重ねた論理解像度の画面
+	screen *sdl.Texture
+	// 実行中の画面効果
+	transition *transitionState
+	// 接触しているスプライトの組（値はCollisionStayを送るか否か）
+	contacts map[collisionPair]bool
+	// スプライトに対するカーソルの状態
+	pointer pointerState
+	// 実行中の画面の保存
+	captures []*captureJob
+	// 画像ファイルの変更の検知（nilなら無効）
+	reload *hotReload
+	// Appへ送信待ちのイベント
+	events []data.Event
+	// デバッグ表示
+	debug debugOverlay
+	// 書き出したスプライトの集計（frameDrawは集計中のもの）
+	frameDraw   DrawStats
+	drawStats   DrawStats
+	mtxStats    sync.Mutex
+	lastTexture *sdl.Texture // 直前の書き出しに使ったテクスチャ
+	// 書き出しが追いつかず記録しなかった画面の数（mtxStatsで保護する）
+	captureDropped int
+	// 未反映の描画の指示
+	directions    []data.Direction
+	mtxDirections sync.Mutex
 }
 
 /*
 NewRendererはRendererを初期化します。指定した Windowにsdl.Rendererを追加します。
-}*/
+}
+*/
 func NewRenderer(win *sdl.Window) (*Renderer, error) {
 	var err error
 	renderer := Renderer{}
@@ -41,37 +99,99 @@ func NewRenderer(win *sdl.Window) (*Renderer, error) {
 	if err != nil {
 		return &renderer, err
 	}
+	renderer.initState()
+	// 論理解像度の初期値はウィンドウの大きさ
+	w, h := win.GetSize()
+	if err = renderer.SetLogicalSize(w, h, ScaleFit, FilterNearest); err != nil {
+		return &renderer, err
+	}
+	return &renderer, nil
+}
+
+/*
+initStateは、レイヤーやスプライト画像などの管理に使うmapを作成します。
+*/
+func (renderer *Renderer) initState() {
 	renderer.Layers = make(map[data.LayerIdentifier]map[data.SpriteIdentifier]*data.Sprite)
 	renderer.LayerTextures = make(map[data.LayerIdentifier]*sdl.Texture)
 	renderer.LayerUpdated = make(map[data.LayerIdentifier]bool)
+	renderer.layerProperties = make(map[data.LayerIdentifier]data.LayerProperty)
+	renderer.layerIndex = make(map[data.LayerIdentifier]*spatialIndex)
+	renderer.layerDirty = make(map[data.LayerIdentifier]*dirtyRegion)
+	renderer.viewports = make(map[data.ViewportIdentifier]*viewportState)
 	renderer.SpriteImages = make(map[data.ImageIdentifier]*data.SpriteImage)
-	return &renderer, nil
+	renderer.masks = make(map[data.ImageIdentifier]*alphaMask)
+	renderer.assets = newAssetManager()
+	renderer.contacts = make(map[collisionPair]bool)
+	renderer.tweens = make(map[data.SpriteIdentifier]*tweenEntry)
+	renderer.fonts = make(map[data.FontIdentifier]textFont)
+	renderer.spriteLayers = make(map[data.SpriteIdentifier]data.LayerIdentifier)
+	renderer.locals = make(map[data.SpriteIdentifier]*data.Sprite)
+	renderer.emitters = make(map[data.SpriteIdentifier]*emitterState)
 }
 
 /*
 AddRayerはRendererに指定したIDで描画レイヤーを追加します。
 */
 func (renderer *Renderer) AddLayer(identifier data.LayerIdentifier) error {
-	var err error
-	renderer.Layers[identifier] = make(map[data.SpriteIdentifier]*data.Sprite)
-	w, h := renderer.Window.GetSize()
-	renderer.LayerTextures[identifier], err = renderer.SdlRenderer.CreateTexture(
-		sdl.PIXELFORMAT_RGBA8888,
-		sdl.TEXTUREACCESS_TARGET,
-		w,
-		h,
+	return renderer.AddLayerWithProperty(identifier, data.NewLayerProperty())
+}
+
+/*
+AddLayerWithPropertyはRendererに指定したIDと設定で描画レイヤーを追加します。
+追加済みのレイヤーを指定した場合は、設定のみを更新します。
+*/
+func (renderer *Renderer) AddLayerWithProperty(identifier data.LayerIdentifier, property data.LayerProperty) error {
+	if _, ok := renderer.Layers[identifier]; ok {
+		renderer.SetLayerProperty(identifier, property)
+		return nil
+	}
+	texture, err := renderer.createTargetTexture(
+		renderer.logicalW,
+		renderer.logicalH,
+		FilterNearest,
 	)
 	if err != nil {
 		return err
 	}
-	renderer.LayerUpdated[identifier] = false
+	renderer.Layers[identifier] = make(map[data.SpriteIdentifier]*data.Sprite)
+	renderer.LayerTextures[identifier] = texture
+	renderer.layerProperties[identifier] = property
+	renderer.layerIndex[identifier] = newSpatialIndex()
+	renderer.markLayerDirty(identifier)
 	return nil
 }
 
+/*
+SetLayerPropertyは、レイヤーの表示の設定を更新します。存在しないレイヤーの場合は何もしません。
+*/
+func (renderer *Renderer) SetLayerProperty(identifier data.LayerIdentifier, property data.LayerProperty) {
+	old, ok := renderer.layerProperties[identifier]
+	if !ok {
+		return
+	}
+	renderer.layerProperties[identifier] = property
+	// 重ねる順が変わる場合はスプライトを書き直す
+	if old.Sort != property.Sort {
+		renderer.markLayerDirty(identifier)
+	}
+}
+
+/*
+LayerPropertyは、レイヤーの表示の設定を返します。
+*/
+func (renderer *Renderer) LayerProperty(identifier data.LayerIdentifier) (data.LayerProperty, bool) {
+	property, ok := renderer.layerProperties[identifier]
+	return property, ok
+}
+
 /*
 AddSpriteImagesは指定したファイルをwidth, heightの大きさで裁断してSpriteととしてRendererに追加します。
 指定する画像は、width,heightの大きさで横にhorizontal分だけ並んでいる想定です。（つまりhorizontalの個数で折り返します）
 identitiesに指定した識別子の件数分だけ読み込みます。
+読み込み済みのファイルの場合はテクスチャを共有します。
+読み込んだテクスチャは、RemoveSpriteImagesで全ての画像の登録を取り消すと破棄されます。
+SetTextureBudgetで上限を設定した場合は、スプライトから使われていない間に破棄され、スプライトが再び使う時に読み込み直されます。
 */
 func (renderer *Renderer) AddSpriteImages(
 	filename string,
@@ -80,15 +200,12 @@ func (renderer *Renderer) AddSpriteImages(
 	horizontal int,
 	identifiers []data.ImageIdentifier,
 ) error {
-	image, err := img.Load(filename)
+	renderer.assets.mtx.Lock()
+	defer renderer.assets.mtx.Unlock()
+	texture, err := renderer.loadTexture(filename)
 	if err != nil {
 		return err
 	}
-	tx, err := renderer.SdlRenderer.CreateTextureFromSurface(image)
-	if err != nil {
-		image.Free()
-		return err
-	}
 
 	id := 0 // 作業中のidentifier
 	for y := 0; y < len(identifiers)/horizontal; y++ {
@@ -99,116 +216,347 @@ func (renderer *Renderer) AddSpriteImages(
 				width,
 				height,
 			}
-			img := data.SpriteImage{tx, r}
-			renderer.SpriteImages[identifiers[id]] = &img
+			renderer.putSheetImage(texture, identifiers[id], r)
 			id += 1
 		}
 	}
+	renderer.enforceBudget()
 	return nil
 }
 
 /*
 addSpriteForLayerはレイヤーにスプライトを追加・または更新します
+別のレイヤーに登録済みのスプライトは、元のレイヤーから取り除かれます。
+存在しないレイヤーを指定したスプライトは破棄されます。
+親を持つスプライトの画面上の位置などは、次にresolveHierarchyを呼び出した時に求めます。
+スプライトは複製して保持するため、呼び出し元のスプライトはそのまま使い続けることができます。
 */
-func (renderer *Renderer) AddSpriteForLayer(sprite data.Sprite) {
+func (renderer *Renderer) AddSpriteForLayer(sprite *data.Sprite) {
+	renderer.addSprite(sprite.Clone())
+}
+
+/*
+addSpriteは、スプライトをそのままレイヤーに追加・または更新します
+スプライトはRendererが保持するため、呼び出し元で使い回してはいけません。
+*/
+func (renderer *Renderer) addSprite(sprite *data.Sprite) {
 	layerID := sprite.LayerID
-	renderer.Layers[layerID][sprite.Id] = &sprite
-	renderer.LayerUpdated[layerID] = true
+	if _, ok := renderer.Layers[layerID]; !ok {
+		return
+	}
+	if old, ok := renderer.findSprite(sprite.Id); ok {
+		renderer.markSpriteDirty(old)
+		renderer.unindexSprite(old.LayerID, sprite.Id)
+		delete(renderer.Layers[old.LayerID], sprite.Id)
+	}
+	if sprite.HasParent() {
+		renderer.locals[sprite.Id] = sprite.Clone()
+	} else {
+		delete(renderer.locals, sprite.Id)
+	}
+	renderer.Layers[layerID][sprite.Id] = sprite
+	renderer.spriteLayers[sprite.Id] = layerID
+	renderer.indexSprite(sprite)
+	renderer.markSpriteDirty(sprite)
+	renderer.restoreImages(sprite)
+	if sprite.Tweens != nil {
+		renderer.tweens[sprite.Id] = newTweenEntry(sprite)
+	}
+	if sprite.Kind == data.KindEmitter {
+		renderer.putEmitter(sprite)
+	}
+}
+
+/*
+Updateは、前回の呼び出しからの経過時間（ミリ秒）だけTween、パーティクル、画面効果と画面の記録を進め、
+親を持つスプライトの位置などを求め直してから、スプライトの接触と画像ファイルの変更を調べます。
+Pilotのフレームごとに呼び出されます。
+*/
+func (renderer *Renderer) Update(delta uint32) {
+	renderer.UpdateTweens(delta)
+	renderer.UpdateParticles(delta)
+	renderer.resolveHierarchy()
+	renderer.updateCollisions()
+	renderer.updateTransition(delta)
+	renderer.updateCaptures(delta)
+	renderer.updateHotReload(delta)
+}
+
+/*
+pushEventは、Appへ送信するイベントを送信待ちにします。
+*/
+func (renderer *Renderer) pushEvent(event data.Event) {
+	renderer.events = append(renderer.events, event)
 }
 
 /*
-drawSpriteForLayerはレイヤーを書き出します
+TakeEventsは、送信待ちのイベントを取り出します。
+*/
+func (renderer *Renderer) TakeEvents() []data.Event {
+	events := renderer.events
+	renderer.events = nil
+	return events
+}
+
+/*
+drawSpriteForLayerはレイヤーのうち、書き直しが必要な範囲を書き出します
+レイヤーのテクスチャは使い回し、書き直す範囲だけを透明にしてからスプライトを重ねます。
+空間インデックスから画面内かつ書き直す範囲内にあるスプライトだけを取り出し、同じテクスチャのまとまりごとに書き出します。
 */
 func (renderer *Renderer) drawSpriteForLayer(layerID data.LayerIdentifier) error {
 	var err error
-	// 対象のレイヤーテクスチャをクリアーする
-	if err = renderer.LayerTextures[layerID].Destroy(); err != nil {
-		return err
-	}
-	w, h := renderer.Window.GetSize()
-	if renderer.LayerTextures[layerID], err = renderer.SdlRenderer.CreateTexture(
-		sdl.PIXELFORMAT_RGBA8888,
-		sdl.TEXTUREACCESS_TARGET,
-		w,
-		h,
-	); err != nil {
-		return err
-	}
 	// 対象レイヤーを編集ターゲットにする
 	texture := renderer.LayerTextures[layerID]
-	if err := renderer.SdlRenderer.SetRenderTarget(texture); err != nil {
+	if err = renderer.SdlRenderer.SetRenderTarget(texture); err != nil {
 		return err
 	}
-	if err := renderer.SdlRenderer.Clear(); err != nil {
-		return err
+	region := renderer.dirtyRegion(layerID)
+	defer delete(renderer.layerDirty, layerID)
+	var clips []*sdl.Rect
+	if region.full {
+		clips = []*sdl.Rect{nil}
+	} else {
+		for i := range region.rects {
+			clips = append(clips, &region.rects[i])
+		}
 	}
-	spriteArray := getSpriteArraySortedPriority(renderer.Layers[layerID])
-	// 実際に書き出す
-	for _, sprite := range spriteArray {
-		if sprite == nil {
-			continue
+	defer renderer.SdlRenderer.SetClipRect(nil)
+	renderer.lastTexture = nil
+
+	screen := sdl.Rect{W: renderer.logicalW, H: renderer.logicalH}
+	drawn := make(map[data.SpriteIdentifier]bool)
+	for _, clip := range clips {
+		// 書き直す範囲を透明にする。図形などの書き出しで変わるため、範囲ごとに設定し直す
+		if err = renderer.SdlRenderer.SetClipRect(clip); err != nil {
+			return err
+		}
+		renderer.SdlRenderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+		renderer.SdlRenderer.SetDrawColor(0, 0, 0, 0)
+		area := screen
+		if clip == nil {
+			err = renderer.SdlRenderer.Clear()
+		} else {
+			err = renderer.SdlRenderer.FillRect(clip)
+			area, _ = screen.Intersect(clip)
 		}
-		si, ok := renderer.SpriteImages[sprite.SrcImageID]
-		if !ok {
-			return errors.New("Unknown Sprite Image.")
+		if err != nil {
+			return err
 		}
-		point := sdl.Point{
-			X: sprite.Rotate.CenterX,
-			Y: sprite.Rotate.CenterY,
+		// 実際に書き出す
+		sprites := renderer.visibleSprites(layerID, area)
+		for _, sprite := range sprites {
+			drawn[sprite.Id] = true
 		}
-		var flip sdl.RendererFlip
-		switch sprite.Flip {
-		case data.NoFlip:
-			flip = sdl.FLIP_NONE
-		case data.Horizontal:
-			flip = sdl.FLIP_HORIZONTAL
-		case data.Vertical:
-			flip = sdl.FLIP_VERTICAL
+		if err = renderer.drawBatched(sprites); err != nil {
+			return err
 		}
-		renderer.SdlRenderer.CopyEx(
-			si.SpriteTable,
-			si.Rect.ToSdlRect(),
-			sprite.DistRect.ToSdlRect(),
-			sprite.Rotate.Angle,
-			&point,
-			flip,
-		)
 	}
+	renderer.frameDraw.Layers++
+	renderer.frameDraw.Drawn += len(drawn)
+	renderer.frameDraw.Culled += len(renderer.Layers[layerID]) - len(drawn)
 	return nil
 }
 
+/*
+visibleSpritesは、レイヤーのスプライトのうち、範囲内にある表示中のものを書き出す順に返します。
+*/
+func (renderer *Renderer) visibleSprites(layerID data.LayerIdentifier, area sdl.Rect) []*data.Sprite {
+	index, ok := renderer.layerIndex[layerID]
+	if !ok {
+		return nil
+	}
+	var sprites []*data.Sprite
+	for _, sprite := range getSpriteArraySortedPriority(index.query(area), renderer.layerProperties[layerID].Sort) {
+		if sprite.Hidden {
+			continue
+		}
+		// 文字列と粒子は矩形の外にも書き出されるため、常に書き出す
+		if sprite.Kind != data.KindText && sprite.Kind != data.KindEmitter {
+			bounds := spriteBounds(sprite)
+			if !area.HasIntersection(&bounds) {
+				continue
+			}
+		}
+		sprites = append(sprites, sprite)
+	}
+	return sprites
+}
+
+/*
+drawSpriteは、スプライトを種類に応じて書き出します
+*/
+func (renderer *Renderer) drawSprite(sprite *data.Sprite) error {
+	switch sprite.Kind {
+	case data.KindText:
+		return renderer.drawText(sprite)
+	case data.KindShape:
+		return renderer.drawShape(sprite)
+	case data.KindEmitter:
+		return renderer.drawParticles(sprite)
+	}
+	return renderer.drawImage(sprite)
+}
+
+/*
+drawImageはスプライト画像を書き出します
+*/
+func (renderer *Renderer) drawImage(sprite *data.Sprite) error {
+	si, ok := renderer.SpriteImages[sprite.SrcImageID]
+	if !ok {
+		return errors.New("Unknown Sprite Image.")
+	}
+	si.SpriteTable.SetAlphaMod(sprite.Alpha)
+	si.SpriteTable.SetColorMod(sprite.ColorMod.R, sprite.ColorMod.G, sprite.ColorMod.B)
+	si.SpriteTable.SetBlendMode(sdlBlendMode(sprite.Blend))
+	if sprite.Slice != data.SliceNone && !si.Slice.IsZero() {
+		dist, point := spriteDist(sprite)
+		dist.X -= renderer.origin.X
+		dist.Y -= renderer.origin.Y
+		return renderer.drawNineSlice(sprite, si, dist, point)
+	}
+	// 小数の位置と大きさのまま書き出す
+	x, y, w, h, px, py := spriteGeometry(sprite)
+	x -= float64(renderer.origin.X)
+	y -= float64(renderer.origin.Y)
+	renderer.countDraw(si.SpriteTable)
+	return renderer.SdlRenderer.CopyExF(
+		si.SpriteTable,
+		si.Rect.ToSdlRect(),
+		&sdl.FRect{X: float32(x), Y: float32(y), W: float32(w), H: float32(h)},
+		sprite.Rotate.Angle,
+		&sdl.FPoint{X: float32(px), Y: float32(py)},
+		sdlFlip(sprite.Flip),
+	)
+}
+
+/*
+sdlFlipは、裏返しをSDLの裏返しに変換します。
+*/
+func sdlFlip(flip data.Flip) sdl.RendererFlip {
+	result := sdl.RendererFlip(sdl.FLIP_NONE)
+	if flip&data.Horizontal != 0 {
+		result |= sdl.FLIP_HORIZONTAL
+	}
+	if flip&data.Vertical != 0 {
+		result |= sdl.FLIP_VERTICAL
+	}
+	return result
+}
+
+/*
+sdlBlendModeは、合成方法をSDLの合成方法に変換します。
+*/
+func sdlBlendMode(blend data.BlendMode) sdl.BlendMode {
+	switch blend {
+	case data.BlendAdd:
+		// 透明な部分に加算しても見えるように、不透明度も加算する
+		return sdl.ComposeCustomBlendMode(
+			sdl.BLENDFACTOR_SRC_ALPHA, sdl.BLENDFACTOR_ONE, sdl.BLENDOPERATION_ADD,
+			sdl.BLENDFACTOR_ONE, sdl.BLENDFACTOR_ONE, sdl.BLENDOPERATION_ADD,
+		)
+	case data.BlendModulate:
+		return sdl.BLENDMODE_MOD
+	case data.BlendMultiply:
+		return sdl.ComposeCustomBlendMode(
+			sdl.BLENDFACTOR_DST_COLOR, sdl.BLENDFACTOR_ONE_MINUS_SRC_ALPHA, sdl.BLENDOPERATION_ADD,
+			sdl.BLENDFACTOR_ZERO, sdl.BLENDFACTOR_ONE, sdl.BLENDOPERATION_ADD,
+		)
+	case data.BlendNone:
+		return sdl.BLENDMODE_NONE
+	}
+	return sdl.BLENDMODE_BLEND
+}
+
 /*
 DrawLayersはレイヤーを順番に書き出します。
+更新されていないレイヤーは、前回書き出したテクスチャをそのまま重ねます。
+ビューポートを設定している場合は、ビューポートごとにレイヤーを書き出して画面に重ねます。
 */
 func (renderer *Renderer) DrawLayers() error {
+	renderer.resolveHierarchy()
+	renderer.frameDraw = DrawStats{}
 	ids := renderer.getLayerIDs()
-	for _, id := range ids {
-		// 更新ずみの場合のみ、スプライト書き出し処理を行う
-		if _, ok := renderer.LayerUpdated[id]; ok {
-			if err := renderer.drawSpriteForLayer(id); err != nil {
-				return err
+	if len(renderer.viewports) > 0 {
+		// ビューポートを使う間は、レイヤーの画像は書き直しが必要な範囲を残したまま使わない
+		if err := renderer.drawViewports(ids); err != nil {
+			return err
+		}
+	} else {
+		for _, id := range ids {
+			// 更新ずみの場合のみ、スプライト書き出し処理を行う
+			if renderer.LayerUpdated[id] {
+				if err := renderer.drawSpriteForLayer(id); err != nil {
+					return err
+				}
+				renderer.LayerUpdated[id] = false
 			}
-			renderer.LayerUpdated[id] = false
-		} else {
-			return errors.New("Access By Invalid Layer Id")
 		}
-		// 画面に書き出す
-		if err := renderer.SdlRenderer.SetRenderTarget(nil); err != nil {
+	}
+	renderer.mtxStats.Lock()
+	renderer.drawStats = renderer.frameDraw
+	renderer.mtxStats.Unlock()
+	// 論理解像度の画面に重ねる
+	if err := renderer.SdlRenderer.SetRenderTarget(renderer.screen); err != nil {
+		return err
+	}
+	renderer.SdlRenderer.SetDrawColor(0, 0, 0, 255)
+	if err := renderer.SdlRenderer.Clear(); err != nil {
+		return err
+	}
+	if len(renderer.viewports) > 0 {
+		if err := renderer.compositeViewports(); err != nil {
 			return err
 		}
-		renderer.SdlRenderer.Copy(renderer.LayerTextures[id], nil, nil)
-
+	} else {
+		for _, id := range ids {
+			texture, ok := renderer.LayerTextures[id]
+			if !ok {
+				return errors.New("Access By Invalid Layer Id")
+			}
+			if err := renderer.compositeLayer(texture, renderer.layerProperties[id]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := renderer.drawTransition(); err != nil {
+		return err
+	}
+	if err := renderer.captureScreen(); err != nil {
+		return err
+	}
+	if err := renderer.drawDebugOverlay(); err != nil {
+		return err
+	}
+	// ウィンドウに書き出す
+	if err := renderer.presentScreen(); err != nil {
+		return err
 	}
-	renderer.SdlRenderer.Present()
 	renderer.Window.UpdateSurface()
 	return nil
 }
 
+/*
+compositeLayerは、レイヤーの設定を適用してレイヤーの画像を画面に重ねます。
+*/
+func (renderer *Renderer) compositeLayer(texture *sdl.Texture, property data.LayerProperty) error {
+	if property.Hidden || property.Alpha == 0 {
+		return nil
+	}
+	texture.SetAlphaMod(property.Alpha)
+	texture.SetColorMod(property.Tint.R, property.Tint.G, property.Tint.B)
+	texture.SetBlendMode(sdlBlendMode(property.Blend))
+	if property.Clip.Width <= 0 || property.Clip.Height <= 0 {
+		return renderer.SdlRenderer.Copy(texture, nil, nil)
+	}
+	clip := property.Clip.ToSdlRect()
+	return renderer.SdlRenderer.Copy(texture, clip, clip)
+}
+
 /*
 getLayerIDsは、指定レイヤーの全てのレイヤーIDを昇順にソートして返却します
 */
-func (renderer Renderer) getLayerIDs() []data.LayerIdentifier {
-	ids := make([]data.LayerIdentifier, len(renderer.LayerUpdated))
+func (renderer *Renderer) getLayerIDs() []data.LayerIdentifier {
+	ids := make([]data.LayerIdentifier, 0, len(renderer.LayerUpdated))
 	for key, _ := range renderer.LayerUpdated {
 		ids = append(ids, key)
 	}
@@ -218,20 +566,46 @@ func (renderer Renderer) getLayerIDs() []data.LayerIdentifier {
 	return ids
 }
 
-// getSpriteArraySortedPriorityは、SpriteIDをキーにしたSpriteのmapから、priority順の配列に変換
+// getSpriteArraySortedPriorityは、SpriteIDをキーにしたSpriteのmapから、書き出す順（priority順）の配列に変換
 func getSpriteArraySortedPriority(
 	spriteMap map[data.SpriteIdentifier]*data.Sprite,
+	mode data.SortMode,
 ) []*data.Sprite {
-	spriteArray := make([]*data.Sprite, len(spriteMap))
+	spriteArray := make([]*data.Sprite, 0, len(spriteMap))
 	for _, tx := range spriteMap {
 		spriteArray = append(spriteArray, tx)
 	}
-	//fmt.Println(spriteArray)
-	// LayerのSprite配列をPriority順にソート
-	/*
-		sort.Slice(spriteArray, func(i, j int) bool {
-			return spriteArray[i].Priority < spriteArray[j].Priority
-		})
-	*/
+	// LayerのSprite配列をPriority順にソート。mapの順に左右されないよう、同じ優先度でも順を決める
+	sort.Slice(spriteArray, func(i, j int) bool {
+		return drawsBefore(spriteArray[i], spriteArray[j], mode)
+	})
 	return spriteArray
 }
+
+/*
+drawsBeforeは、同じレイヤーのスプライトaがbより先に（下に）書き出されるか否かを返します。
+Priorityの小さいものを先にし、同じ場合はレイヤーの重ねる順、最後にIDの順で決めます。
+*/
+func drawsBefore(a, b *data.Sprite, mode data.SortMode) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if mode == data.SortY {
+		if ya, yb := sortBaseline(a), sortBaseline(b); ya != yb {
+			return ya < yb
+		}
+	}
+	return bytes.Compare(a.Id[:], b.Id[:]) < 0
+}
+
+/*
+sortBaselineは、上から順に重ねる際に使うスプライトの縦の位置を返します。
+基準点を使うスプライトは基準点の位置、それ以外は拡大率を反映した下端です。
+*/
+func sortBaseline(sprite *data.Sprite) float64 {
+	if sprite.UsePivot {
+		return sprite.Position().Y
+	}
+	_, y, _, h, _, _ := spriteGeometry(sprite)
+	return y + h
+}
@@ -0,0 +1,89 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestSpriteArraySortedPriority(t *testing.T) {
+	sprite := func(id byte, priority int32, top int32) *data.Sprite {
+		return &data.Sprite{
+			Id:       data.SpriteIdentifier{id},
+			DistRect: data.Rect{Top: top, Width: 10, Height: 10},
+			Priority: priority,
+			ScaleX:   1,
+			ScaleY:   1,
+		}
+	}
+	sprites := map[data.SpriteIdentifier]*data.Sprite{}
+	for _, s := range []*data.Sprite{sprite(3, 0, 0), sprite(1, 0, 50), sprite(2, 1000, 0), sprite(4, -1000, 90)} {
+		sprites[s.Id] = s
+	}
+	order := func(mode data.SortMode) []byte {
+		var ids []byte
+		for _, s := range getSpriteArraySortedPriority(sprites, mode) {
+			ids = append(ids, s.Id[0])
+		}
+		return ids
+	}
+	// mapの順に関わらず毎回同じ順になる
+	for i := 0; i < 20; i++ {
+		if got := order(data.SortPriority); string(got) != string([]byte{4, 1, 3, 2}) {
+			t.Fatalf("priority order: %v", got)
+		}
+	}
+	// 下端が上にあるものから順。Priorityの方を優先する
+	if got := order(data.SortY); string(got) != string([]byte{4, 3, 1, 2}) {
+		t.Errorf("y order: %v", got)
+	}
+	// 基準点を使う場合は基準点の位置で比べる
+	sprites[data.SpriteIdentifier{3}].DistRect.Top = 55
+	if got := order(data.SortY); string(got) != string([]byte{4, 1, 3, 2}) {
+		t.Errorf("bottom order: %v", got)
+	}
+	sprites[data.SpriteIdentifier{3}].UsePivot = true
+	if got := order(data.SortY); string(got) != string([]byte{4, 3, 1, 2}) {
+		t.Errorf("pivot order: %v", got)
+	}
+}
+
+func TestPutSpriteKeepsZeroValues(t *testing.T) {
+	renderer := &Renderer{}
+	renderer.initState()
+	renderer.Layers[0] = make(map[data.SpriteIdentifier]*data.Sprite)
+	// Tweenで消したスプライトを置き直しても、不透明度や拡大率の0はそのまま使う
+	sprite := data.NewSprite(0)
+	sprite.Alpha, sprite.ScaleX, sprite.ScaleY = 0, 0, 0
+	renderer.AddSpriteForLayer(&sprite)
+	put, ok := renderer.findSprite(sprite.Id)
+	if !ok || put.Alpha != 0 || put.ScaleX != 0 || put.ScaleY != 0 {
+		t.Errorf("zero values replaced: %+v", put)
+	}
+	// 黒や透明の色の乗算も指定したまま使う
+	sprite = data.NewSprite(0)
+	sprite.ColorMod = data.Color{}
+	renderer.AddSpriteForLayer(&sprite)
+	if put, _ := renderer.findSprite(sprite.Id); put.ColorMod != (data.Color{}) {
+		t.Errorf("black color mod replaced: %+v", put.ColorMod)
+	}
+	// NewSpriteで作成したスプライトは、元の見た目のまま書き出す
+	sprite = data.NewSprite(0)
+	if sprite.Alpha != 255 || sprite.ScaleX != 1 || sprite.ScaleY != 1 || sprite.ColorMod != (data.Color{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("new sprite: alpha %d scale %v,%v color %+v", sprite.Alpha, sprite.ScaleX, sprite.ScaleY, sprite.ColorMod)
+	}
+}
+
+func TestSetLayerPropertyKeepsZeroAlpha(t *testing.T) {
+	renderer := &Renderer{}
+	renderer.initState()
+	renderer.layerProperties[0] = data.NewLayerProperty()
+	// 不透明度の0は、フェードアウトした状態としてそのまま使う
+	property := data.NewLayerProperty()
+	property.Alpha = 0
+	property.Tint = data.Color{A: 255}
+	renderer.SetLayerProperty(0, property)
+	if got, _ := renderer.LayerProperty(0); got.Alpha != 0 || got.Tint != (data.Color{A: 255}) {
+		t.Errorf("zero values replaced: %+v", got)
+	}
+}
@@ -0,0 +1,190 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// ScalePolicyは、論理解像度の画面をウィンドウに合わせて拡大する方法の列挙型です
+type ScalePolicy int8
+
+// ScalePolicy型の値
+const (
+	ScaleFit     ScalePolicy = iota // 縦横比を保ってウィンドウに収まる最大の大きさにする（余白は帯で埋める）
+	ScaleInteger                    // 縦横比を保って整数倍に拡大する（余白は帯で埋める）
+	ScaleStretch                    // 縦横比を無視してウィンドウ全体に引き延ばす
+)
+
+// ScaleFilterは、拡大する際の補間方法の列挙型です
+type ScaleFilter int8
+
+// ScaleFilter型の値
+const (
+	FilterNearest ScaleFilter = iota // 最近傍（ドット絵向け）
+	FilterLinear                     // 線形補間
+)
+
+/*
+SetLogicalSizeは、ウィンドウの大きさとは別に、スプライトを配置する論理解像度を設定します。
+レイヤーのテクスチャは論理解像度で作り直され、画面に書き出す際にpolicyに従って拡大されます。
+*/
+func (renderer *Renderer) SetLogicalSize(width, height int32, policy ScalePolicy, filter ScaleFilter) error {
+	renderer.logicalW = width
+	renderer.logicalH = height
+	renderer.scalePolicy = policy
+	renderer.scaleFilter = filter
+	// 保存した画面は大きさが合わなくなるため、画面効果は中断する
+	renderer.stopTransition()
+	if renderer.screen != nil {
+		renderer.screen.Destroy()
+	}
+	var err error
+	if renderer.screen, err = renderer.createTargetTexture(width, height, filter); err != nil {
+		return err
+	}
+	for id, texture := range renderer.LayerTextures {
+		texture.Destroy()
+		if renderer.LayerTextures[id], err = renderer.createTargetTexture(width, height, FilterNearest); err != nil {
+			return err
+		}
+		renderer.markLayerDirty(id)
+	}
+	return nil
+}
+
+/*
+LogicalSizeは、論理解像度を返します。
+*/
+func (renderer *Renderer) LogicalSize() (int32, int32) {
+	return renderer.logicalW, renderer.logicalH
+}
+
+/*
+SetLetterboxColorは、画面の余白を埋める帯の色を設定します。
+*/
+func (renderer *Renderer) SetLetterboxColor(color data.Color) {
+	renderer.letterbox = color
+}
+
+/*
+SetVSyncは、垂直同期の有効・無効を切り替えます（SDL 2.0.18以降）。
+無効にした場合は、PilotのSetFPSLimitでフレーム数の上限を設定してください。
+*/
+func (renderer *Renderer) SetVSync(vsync bool) error {
+	return renderer.SdlRenderer.RenderSetVSync(vsync)
+}
+
+/*
+createTargetTextureは、書き出し先として使う透明なテクスチャを作成します。
+*/
+func (renderer *Renderer) createTargetTexture(width, height int32, filter ScaleFilter) (*sdl.Texture, error) {
+	// 補間方法はテクスチャの作成時に決まる
+	quality := "nearest"
+	if filter == FilterLinear {
+		quality = "linear"
+	}
+	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, quality)
+	texture, err := renderer.SdlRenderer.CreateTexture(
+		sdl.PIXELFORMAT_RGBA8888,
+		sdl.TEXTUREACCESS_TARGET,
+		width,
+		height,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// 下のレイヤーに透明な部分を重ねられるようにする
+	if err = texture.SetBlendMode(sdl.BLENDMODE_BLEND); err != nil {
+		texture.Destroy()
+		return nil, err
+	}
+	return texture, nil
+}
+
+/*
+screenRectは、論理解像度の画面を書き出すウィンドウ上の矩形（出力ピクセル単位）を返します。
+*/
+func (renderer *Renderer) screenRect() sdl.Rect {
+	outW, outH, err := renderer.SdlRenderer.GetOutputSize()
+	if err != nil {
+		outW, outH = renderer.Window.GetSize()
+	}
+	return fitScreen(outW, outH, renderer.logicalW, renderer.logicalH, renderer.scalePolicy)
+}
+
+/*
+fitScreenは、論理解像度の画面をpolicyに従って出力の大きさに合わせた矩形を返します。
+余白が出る場合は、画面を中央に置きます。
+*/
+func fitScreen(outW, outH, logicalW, logicalH int32, policy ScalePolicy) sdl.Rect {
+	if policy == ScaleStretch {
+		return sdl.Rect{X: 0, Y: 0, W: outW, H: outH}
+	}
+	scale := math.Min(float64(outW)/float64(logicalW), float64(outH)/float64(logicalH))
+	if policy == ScaleInteger && scale >= 1 {
+		scale = math.Floor(scale)
+	}
+	w := int32(float64(logicalW) * scale)
+	h := int32(float64(logicalH) * scale)
+	return sdl.Rect{X: (outW - w) / 2, Y: (outH - h) / 2, W: w, H: h}
+}
+
+/*
+presentScreenは、論理解像度の画面をウィンドウに拡大して書き出します。
+*/
+func (renderer *Renderer) presentScreen() error {
+	if err := renderer.SdlRenderer.SetRenderTarget(nil); err != nil {
+		return err
+	}
+	c := renderer.letterbox
+	renderer.SdlRenderer.SetDrawColor(c.R, c.G, c.B, 255)
+	if err := renderer.SdlRenderer.Clear(); err != nil {
+		return err
+	}
+	dst := renderer.screenRect()
+	if err := renderer.SdlRenderer.Copy(renderer.screen, nil, &dst); err != nil {
+		return err
+	}
+	renderer.SdlRenderer.Present()
+	return nil
+}
+
+/*
+WindowToLogicalは、ウィンドウ上の座標を論理解像度の座標に変換します。
+*/
+func (renderer *Renderer) WindowToLogical(x, y int32) (int32, int32) {
+	sx, sy := renderer.windowScale()
+	return windowToScreen(x, y, sx, sy, renderer.screenRect(), renderer.logicalW, renderer.logicalH)
+}
+
+/*
+windowToScreenは、ウィンドウ上の座標を出力ピクセルに変換し、dstに書き出した論理解像度の画面の座標にします。
+*/
+func windowToScreen(x, y int32, sx, sy float64, dst sdl.Rect, logicalW, logicalH int32) (int32, int32) {
+	lx := (float64(x)*sx - float64(dst.X)) * float64(logicalW) / float64(dst.W)
+	ly := (float64(y)*sy - float64(dst.Y)) * float64(logicalH) / float64(dst.H)
+	return int32(math.Floor(lx)), int32(math.Floor(ly))
+}
+
+/*
+mouseToLogicalは、マウスの入力情報の座標と移動量を論理解像度に変換します。
+*/
+func (renderer *Renderer) mouseToLogical(mouse *data.Mouse) {
+	sx, sy := renderer.windowScale()
+	dst := renderer.screenRect()
+	mouse.X, mouse.Y = renderer.WindowToLogical(mouse.X, mouse.Y)
+	mouse.MoveX = int32(float64(mouse.MoveX) * sx * float64(renderer.logicalW) / float64(dst.W))
+	mouse.MoveY = int32(float64(mouse.MoveY) * sy * float64(renderer.logicalH) / float64(dst.H))
+}
+
+// windowScaleは、ウィンドウの座標から出力ピクセルへの倍率を返します（高DPI対応）
+func (renderer *Renderer) windowScale() (float64, float64) {
+	winW, winH := renderer.Window.GetSize()
+	outW, outH, err := renderer.SdlRenderer.GetOutputSize()
+	if err != nil || winW == 0 || winH == 0 {
+		return 1, 1
+	}
+	return float64(outW) / float64(winW), float64(outH) / float64(winH)
+}
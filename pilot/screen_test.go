@@ -0,0 +1,58 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestFitScreen(t *testing.T) {
+	cases := []struct {
+		name       string
+		outW, outH int32
+		policy     ScalePolicy
+		want       sdl.Rect
+	}{
+		{"fit exact", 640, 480, ScaleFit, sdl.Rect{X: 0, Y: 0, W: 640, H: 480}},
+		{"fit pillarbox", 1920, 1080, ScaleFit, sdl.Rect{X: 240, Y: 0, W: 1440, H: 1080}},
+		{"fit letterbox", 640, 800, ScaleFit, sdl.Rect{X: 0, Y: 160, W: 640, H: 480}},
+		{"fit shrink", 160, 120, ScaleFit, sdl.Rect{X: 0, Y: 0, W: 160, H: 120}},
+		{"integer", 1920, 1080, ScaleInteger, sdl.Rect{X: 320, Y: 60, W: 1280, H: 960}},
+		// 論理解像度より小さい出力では、整数倍にせず縮小する
+		{"integer shrink", 320, 480, ScaleInteger, sdl.Rect{X: 0, Y: 120, W: 320, H: 240}},
+		{"stretch", 1920, 1080, ScaleStretch, sdl.Rect{X: 0, Y: 0, W: 1920, H: 1080}},
+	}
+	for _, c := range cases {
+		if got := fitScreen(c.outW, c.outH, 640, 480, c.policy); got != c.want {
+			t.Errorf("%s: want %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestWindowToScreen(t *testing.T) {
+	cases := []struct {
+		name   string
+		x, y   int32
+		sx, sy float64 // ウィンドウの座標から出力ピクセルへの倍率
+		dst    sdl.Rect
+		wantX  int32
+		wantY  int32
+	}{
+		{"same size", 100, 50, 1, 1, sdl.Rect{W: 640, H: 480}, 100, 50},
+		{"scaled", 100, 50, 1, 1, sdl.Rect{W: 1280, H: 960}, 50, 25},
+		{"pillarbox", 240, 0, 1, 1, sdl.Rect{X: 240, W: 1440, H: 1080}, 0, 0},
+		{"pillarbox inside", 960, 540, 1, 1, sdl.Rect{X: 240, W: 1440, H: 1080}, 320, 240},
+		// 帯の上の座標は画面の外（負の値や論理解像度以上）になる
+		{"on the band", 100, 0, 1, 1, sdl.Rect{X: 240, W: 1440, H: 1080}, -63, 0},
+		{"letterbox", 320, 400, 1, 1, sdl.Rect{Y: 160, W: 640, H: 480}, 320, 240},
+		{"stretch", 960, 540, 1, 1, sdl.Rect{W: 1920, H: 1080}, 320, 240},
+		// 高DPIでは、ウィンドウの座標を出力ピクセルに直してから変換する
+		{"high dpi", 480, 270, 2, 2, sdl.Rect{X: 240, W: 1440, H: 1080}, 320, 240},
+	}
+	for _, c := range cases {
+		x, y := windowToScreen(c.x, c.y, c.sx, c.sy, c.dst, 640, 480)
+		if x != c.wantX || y != c.wantY {
+			t.Errorf("%s: want %d,%d, got %d,%d", c.name, c.wantX, c.wantY, x, y)
+		}
+	}
+}
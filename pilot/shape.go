@@ -0,0 +1,226 @@
+package pilot
+
+import (
+	"math"
+	"sort"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+/*
+fpointは、図形の頂点を計算するための小数の座標です。
+*/
+type fpoint struct {
+	x float64
+	y float64
+}
+
+/*
+drawShapeは、図形のスプライトを書き出します。
+図形は輪郭の多角形に変換し、拡大・裏返し・回転を反映してから横方向の線分に分解して塗ります。
+*/
+func (renderer *Renderer) drawShape(sprite *data.Sprite) error {
+	shape := sprite.Shape
+	c, mod := shape.Color, sprite.ColorMod
+	renderer.SdlRenderer.SetDrawBlendMode(sdlBlendMode(sprite.Blend))
+	renderer.SdlRenderer.SetDrawColor(
+		mulColor(c.R, mod.R),
+		mulColor(c.G, mod.G),
+		mulColor(c.B, mod.B),
+		mulColor(c.A, sprite.Alpha),
+	)
+	for _, contours := range shapeContours(shape, float64(sprite.DistRect.Width), float64(sprite.DistRect.Height)) {
+		for _, contour := range contours {
+			for i, p := range contour {
+				contour[i] = transformPoint(sprite, p)
+				contour[i].x -= float64(renderer.origin.X)
+				contour[i].y -= float64(renderer.origin.Y)
+			}
+		}
+		if spans := polygonSpans(contours); len(spans) > 0 {
+			renderer.countDraw(nil)
+			if err := renderer.SdlRenderer.FillRects(spans); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+shapeContoursは、図形をDistRectの左上を原点とする輪郭の多角形に変換します。
+一つの要素が一回の塗りつぶしに対応し、その中の複数の輪郭は偶奇規則で塗ります（輪郭線は外側と内側の二重の輪郭）。
+*/
+func shapeContours(shape data.Shape, w, h float64) [][][]fpoint {
+	t := math.Max(float64(shape.Thickness), 1)
+	switch shape.Type {
+	case data.ShapeRect:
+		contours := [][]fpoint{rectContour(0, 0, w, h)}
+		if !shape.Filled && w > 2*t && h > 2*t {
+			contours = append(contours, rectContour(t, t, w-2*t, h-2*t))
+		}
+		return [][][]fpoint{contours}
+	case data.ShapeRoundRect:
+		r := math.Min(float64(shape.Radius), math.Min(w, h)/2)
+		contours := [][]fpoint{roundRectContour(0, 0, w, h, r)}
+		if !shape.Filled && w > 2*t && h > 2*t {
+			contours = append(contours, roundRectContour(t, t, w-2*t, h-2*t, math.Max(r-t, 0)))
+		}
+		return [][][]fpoint{contours}
+	case data.ShapeCircle:
+		contours := [][]fpoint{ellipseContour(w/2, h/2, w/2, h/2)}
+		if !shape.Filled && w > 2*t && h > 2*t {
+			contours = append(contours, ellipseContour(w/2, h/2, w/2-t, h/2-t))
+		}
+		return [][][]fpoint{contours}
+	case data.ShapeLine, data.ShapePolygon:
+		// 頂点はピクセルの中心として扱う
+		points := make([]fpoint, len(shape.Points))
+		for i, p := range shape.Points {
+			points[i] = fpoint{float64(p.X) + 0.5, float64(p.Y) + 0.5}
+		}
+		if shape.Type == data.ShapePolygon {
+			if shape.Filled {
+				return [][][]fpoint{{points}}
+			}
+			if len(points) > 2 {
+				points = append(points, points[0])
+			}
+		}
+		// 線分ごとに塗ることで、重なった部分が偶奇規則で抜けないようにする
+		var segments [][][]fpoint
+		for i := 0; i+1 < len(points); i++ {
+			segments = append(segments, [][]fpoint{lineContour(points[i], points[i+1], t)})
+		}
+		return segments
+	}
+	return nil
+}
+
+// rectContourは、矩形の輪郭を返します
+func rectContour(x, y, w, h float64) []fpoint {
+	return []fpoint{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}
+}
+
+// roundRectContourは、角の丸い矩形の輪郭を返します
+func roundRectContour(x, y, w, h, r float64) []fpoint {
+	if r <= 0 {
+		return rectContour(x, y, w, h)
+	}
+	var points []fpoint
+	corners := []struct{ cx, cy, start float64 }{
+		{x + w - r, y + r, -math.Pi / 2},
+		{x + w - r, y + h - r, 0},
+		{x + r, y + h - r, math.Pi / 2},
+		{x + r, y + r, math.Pi},
+	}
+	n := arcSegments(r) / 4
+	for _, c := range corners {
+		for i := 0; i <= n; i++ {
+			a := c.start + math.Pi/2*float64(i)/float64(n)
+			points = append(points, fpoint{c.cx + r*math.Cos(a), c.cy + r*math.Sin(a)})
+		}
+	}
+	return points
+}
+
+// ellipseContourは、楕円の輪郭を返します
+func ellipseContour(cx, cy, rx, ry float64) []fpoint {
+	n := arcSegments(math.Max(rx, ry))
+	points := make([]fpoint, n)
+	for i := range points {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		points[i] = fpoint{cx + rx*math.Cos(a), cy + ry*math.Sin(a)}
+	}
+	return points
+}
+
+// arcSegmentsは、半径に応じた円周の分割数を返します
+func arcSegments(r float64) int {
+	n := int(2 * math.Pi * r / 2)
+	if n < 16 {
+		return 16
+	}
+	if n > 256 {
+		return 256
+	}
+	return n - n%4
+}
+
+// lineContourは、太さのある線分の輪郭を返します
+func lineContour(a, b fpoint, thickness float64) []fpoint {
+	dx, dy := b.x-a.x, b.y-a.y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return rectContour(a.x-thickness/2, a.y-thickness/2, thickness, thickness)
+	}
+	// 線分に垂直な方向に太さの半分ずつ広げる
+	nx, ny := -dy/length*thickness/2, dx/length*thickness/2
+	return []fpoint{
+		{a.x + nx, a.y + ny},
+		{b.x + nx, b.y + ny},
+		{b.x - nx, b.y - ny},
+		{a.x - nx, a.y - ny},
+	}
+}
+
+/*
+transformPointは、DistRectの左上を原点とする座標に、裏返し・拡大・回転を反映して画面上の座標にします。
+*/
+func transformPoint(sprite *data.Sprite, p fpoint) fpoint {
+	w, h := float64(sprite.DistRect.Width), float64(sprite.DistRect.Height)
+	if sprite.Flip&data.Horizontal != 0 {
+		p.x = w - p.x
+	}
+	if sprite.Flip&data.Vertical != 0 {
+		p.y = h - p.y
+	}
+	left, top, cx, cy := spriteOrigin(sprite)
+	x, y := (p.x-cx)*sprite.ScaleX, (p.y-cy)*sprite.ScaleY
+	if sprite.Rotate.Angle != 0 {
+		rad := sprite.Rotate.Angle * math.Pi / 180
+		sin, cos := math.Sin(rad), math.Cos(rad)
+		x, y = x*cos-y*sin, x*sin+y*cos
+	}
+	return fpoint{
+		x: left + cx + x,
+		y: top + cy + y,
+	}
+}
+
+/*
+polygonSpansは、輪郭の多角形を偶奇規則で塗りつぶす横方向の線分（高さ1の矩形）に分解します。
+ピクセルの中心が内側にあるピクセルを塗ります。
+*/
+func polygonSpans(contours [][]fpoint) []sdl.Rect {
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, contour := range contours {
+		for _, p := range contour {
+			minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+		}
+	}
+	var spans []sdl.Rect
+	var xs []float64
+	for y := math.Floor(minY); y < maxY; y++ {
+		yc := y + 0.5
+		xs = xs[:0]
+		for _, contour := range contours {
+			for i := range contour {
+				a, b := contour[i], contour[(i+1)%len(contour)]
+				if (a.y <= yc) != (b.y <= yc) {
+					xs = append(xs, a.x+(yc-a.y)*(b.x-a.x)/(b.y-a.y))
+				}
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			x0 := int32(math.Ceil(xs[i] - 0.5))
+			x1 := int32(math.Ceil(xs[i+1] - 0.5))
+			if x1 > x0 {
+				spans = append(spans, sdl.Rect{X: x0, Y: int32(y), W: x1 - x0, H: 1})
+			}
+		}
+	}
+	return spans
+}
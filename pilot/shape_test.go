@@ -0,0 +1,56 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+// spanAreaは、線分の面積（塗られるピクセル数）を返します
+func spanArea(contours [][]fpoint) int32 {
+	var area int32
+	for _, span := range polygonSpans(contours) {
+		area += span.W * span.H
+	}
+	return area
+}
+
+func TestPolygonSpansRect(t *testing.T) {
+	spans := polygonSpans([][]fpoint{rectContour(2, 3, 4, 3)})
+	if len(spans) != 3 {
+		t.Fatalf("want 3 rows, got %d", len(spans))
+	}
+	for i, span := range spans {
+		if span.X != 2 || span.Y != int32(3+i) || span.W != 4 {
+			t.Errorf("row %d: %+v", i, span)
+		}
+	}
+}
+
+func TestShapeOutline(t *testing.T) {
+	rect := data.Shape{Type: data.ShapeRect, Thickness: 1}
+	for _, contours := range shapeContours(rect, 4, 4) {
+		// 外周の12ピクセルだけが塗られ、内側の4ピクセルは抜ける
+		if area := spanArea(contours); area != 12 {
+			t.Errorf("outline area: want 12, got %d", area)
+		}
+	}
+	rect.Filled = true
+	for _, contours := range shapeContours(rect, 4, 4) {
+		if area := spanArea(contours); area != 16 {
+			t.Errorf("filled area: want 16, got %d", area)
+		}
+	}
+}
+
+func TestShapeLine(t *testing.T) {
+	line := data.Shape{Type: data.ShapeLine, Points: []data.Point{{X: 0, Y: 2}, {X: 9, Y: 2}}}
+	segments := shapeContours(line, 10, 5)
+	if len(segments) != 1 {
+		t.Fatalf("want 1 segment, got %d", len(segments))
+	}
+	spans := polygonSpans(segments[0])
+	if len(spans) != 1 || spans[0].Y != 2 || spans[0].W != 9 {
+		t.Errorf("horizontal line: %+v", spans)
+	}
+}
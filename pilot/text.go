@@ -0,0 +1,532 @@
+package pilot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/img"
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+)
+
+/*
+textFontは、文字列の書き出しに使うフォントです。
+TrueTypeフォントとビットマップフォントの違いを吸収します。
+*/
+type textFont interface {
+	glyph(renderer *sdl.Renderer, ch rune) (*glyph, error) // 文字の画像を取得する。画像の無い文字はnil
+	advance(ch rune) int32                                 // 文字を書いた後に進む幅
+	kerning(prev, ch rune) int32                           // 文字の組み合わせによる幅の調整
+	lineHeight() int32                                     // 一行の高さ
+}
+
+/*
+glyphは、一文字分の画像です。
+*/
+type glyph struct {
+	texture *sdl.Texture
+	src     sdl.Rect // テクスチャ上の矩形
+	offsetX int32    // 書き出し位置のずれ
+	offsetY int32
+}
+
+/*
+ttfFontは、SDL_ttfで読み込んだTrueTypeフォントです。
+文字の画像は白色で作成してキャッシュし、書き出し時に色を付けます。
+*/
+type ttfFont struct {
+	font     *ttf.Font
+	glyphs   map[rune]*glyph
+	advances map[rune]int32
+	kernings map[[2]rune]int32
+}
+
+func (font *ttfFont) glyph(renderer *sdl.Renderer, ch rune) (*glyph, error) {
+	if g, ok := font.glyphs[ch]; ok {
+		return g, nil
+	}
+	surface, err := font.font.RenderGlyphBlended(ch, sdl.Color{R: 255, G: 255, B: 255, A: 255})
+	if err != nil {
+		return nil, err
+	}
+	defer surface.Free()
+	tx, err := renderer.CreateTextureFromSurface(surface)
+	if err != nil {
+		return nil, err
+	}
+	g := glyph{
+		texture: tx,
+		src:     sdl.Rect{X: 0, Y: 0, W: surface.W, H: surface.H},
+	}
+	font.glyphs[ch] = &g
+	return &g, nil
+}
+
+func (font *ttfFont) advance(ch rune) int32 {
+	if a, ok := font.advances[ch]; ok {
+		return a
+	}
+	var a int32
+	if metrics, err := font.font.GlyphMetrics(ch); err == nil {
+		a = int32(metrics.Advance)
+	}
+	font.advances[ch] = a
+	return a
+}
+
+/*
+kerningは、二文字を続けて書いた幅と一文字ずつの幅の差から、文字の組み合わせによる幅の調整を求めます。
+go-sdl2では文字の組み合わせの調整量を直接取得できないため、SDL_ttfが調整を反映して測る幅を使います。
+*/
+func (font *ttfFont) kerning(prev, ch rune) int32 {
+	if !font.font.GetKerning() {
+		return 0
+	}
+	key := [2]rune{prev, ch}
+	if k, ok := font.kernings[key]; ok {
+		return k
+	}
+	var k int32
+	pair, _, err := font.font.SizeUTF8(string([]rune{prev, ch}))
+	if err == nil {
+		if single, _, err := font.font.SizeUTF8(string(ch)); err == nil {
+			k = int32(pair-single) - font.advance(prev)
+		}
+	}
+	font.kernings[key] = k
+	return k
+}
+
+func (font *ttfFont) lineHeight() int32 {
+	return int32(font.font.LineSkip())
+}
+
+/*
+bitmapFontは、BMFont（AngelCode）形式のビットマップフォントです。
+フォントに無い文字は「?」の文字で代用し、「?」も無い場合は書き出しません。
+*/
+type bitmapFont struct {
+	height   int32
+	glyphs   map[rune]*glyph
+	advances map[rune]int32
+	kernings map[[2]rune]int32
+}
+
+func (font *bitmapFont) glyph(renderer *sdl.Renderer, ch rune) (*glyph, error) {
+	return font.glyphs[font.substitute(ch)], nil
+}
+
+func (font *bitmapFont) advance(ch rune) int32 {
+	return font.advances[font.substitute(ch)]
+}
+
+// substituteは、フォントに無い文字を代わりに書き出す文字に置き換えます
+func (font *bitmapFont) substitute(ch rune) rune {
+	if _, ok := font.glyphs[ch]; ok {
+		return ch
+	}
+	return '?'
+}
+
+func (font *bitmapFont) kerning(prev, ch rune) int32 {
+	return font.kernings[[2]rune{prev, ch}]
+}
+
+func (font *bitmapFont) lineHeight() int32 {
+	return font.height
+}
+
+/*
+AddFontは、TrueTypeフォントファイルを指定した大きさで読み込み、Rendererに追加します。
+*/
+func (renderer *Renderer) AddFont(id data.FontIdentifier, filename string, size int) error {
+	if !ttf.WasInit() {
+		if err := ttf.Init(); err != nil {
+			return err
+		}
+	}
+	f, err := ttf.OpenFont(filename, size)
+	if err != nil {
+		return err
+	}
+	renderer.fonts[id] = &ttfFont{
+		font:     f,
+		glyphs:   make(map[rune]*glyph),
+		advances: make(map[rune]int32),
+		kernings: make(map[[2]rune]int32),
+	}
+	return nil
+}
+
+/*
+AddBitmapFontは、BMFont（AngelCode）形式のテキストファイルを読み込み、Rendererに追加します。
+ページ画像は、fntファイルと同じディレクトリから読み込みます。
+*/
+func (renderer *Renderer) AddBitmapFont(id data.FontIdentifier, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	desc, err := parseBMFont(file)
+	if err != nil {
+		return err
+	}
+	pages := make(map[int]*sdl.Texture)
+	for page, name := range desc.pages {
+		if pages[page], err = img.LoadTexture(renderer.SdlRenderer, filepath.Join(filepath.Dir(filename), name)); err != nil {
+			return err
+		}
+	}
+	font := bitmapFont{
+		height:   desc.lineHeight,
+		glyphs:   make(map[rune]*glyph),
+		advances: make(map[rune]int32),
+		kernings: desc.kernings,
+	}
+	for _, c := range desc.chars {
+		tx, ok := pages[c.page]
+		if !ok {
+			return errors.New(fmt.Sprintf("No page in bitmap font:%d", c.page))
+		}
+		font.glyphs[c.id] = &glyph{
+			texture: tx,
+			src:     c.rect,
+			offsetX: c.offsetX,
+			offsetY: c.offsetY,
+		}
+		font.advances[c.id] = c.advance
+	}
+	renderer.fonts[id] = &font
+	return nil
+}
+
+// bmfontDescは、BMFontのテキストファイルの内容です
+type bmfontDesc struct {
+	lineHeight int32
+	pages      map[int]string
+	chars      []bmfontChar
+	kernings   map[[2]rune]int32
+}
+
+// bmfontCharは、BMFontの一文字分の定義です
+type bmfontChar struct {
+	id      rune
+	rect    sdl.Rect
+	offsetX int32
+	offsetY int32
+	advance int32
+	page    int
+}
+
+/*
+parseBMFontは、BMFontのテキスト形式の定義を読み込みます。
+*/
+func parseBMFont(r io.Reader) (*bmfontDesc, error) {
+	desc := bmfontDesc{
+		pages:    make(map[int]string),
+		kernings: make(map[[2]rune]int32),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		tag, attrs := parseBMFontLine(scanner.Text())
+		num := func(key string) int32 {
+			n, _ := strconv.Atoi(attrs[key])
+			return int32(n)
+		}
+		switch tag {
+		case "common":
+			desc.lineHeight = num("lineHeight")
+		case "page":
+			desc.pages[int(num("id"))] = attrs["file"]
+		case "char":
+			desc.chars = append(desc.chars, bmfontChar{
+				id:      rune(num("id")),
+				rect:    sdl.Rect{X: num("x"), Y: num("y"), W: num("width"), H: num("height")},
+				offsetX: num("xoffset"),
+				offsetY: num("yoffset"),
+				advance: num("xadvance"),
+				page:    int(num("page")),
+			})
+		case "kerning":
+			desc.kernings[[2]rune{rune(num("first")), rune(num("second"))}] = num("amount")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if desc.lineHeight == 0 || len(desc.pages) == 0 {
+		return nil, errors.New("Invalid bitmap font.")
+	}
+	return &desc, nil
+}
+
+// parseBMFontLineは、「tag key=value key="value"」形式の一行を分解します
+func parseBMFontLine(line string) (string, map[string]string) {
+	attrs := make(map[string]string)
+	line = strings.TrimSpace(line)
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return line, attrs
+	}
+	tag, rest := line[:i], line[i+1:]
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := rest[:eq]
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		attrs[key] = value
+	}
+	return tag, attrs
+}
+
+/*
+textLineは、折り返し後の一行分の文字列です。
+*/
+type textLine struct {
+	runes []rune
+	width int32
+}
+
+/*
+layoutTextは、文字列を行に分割し、それぞれの幅を計算します。
+wrapがtrueの場合、widthを超えないように単語の区切りで折り返します。
+単語がwidthより長い場合や、CJKの文字は文字単位で折り返します。
+*/
+func layoutText(font textFont, content string, width int32, wrap bool) []textLine {
+	var lines []textLine
+	for _, paragraph := range strings.Split(content, "\n") {
+		line := textLine{}
+		for _, word := range splitWords(paragraph) {
+			w := measureRunes(font, word, lastRune(line.runes))
+			if wrap && line.width+w > width && len(line.runes) > 0 {
+				lines = append(lines, trimLine(font, line))
+				line = textLine{}
+				if unicode.IsSpace(word[0]) {
+					continue
+				}
+				w = measureRunes(font, word, 0)
+			}
+			if wrap && w > width {
+				// 一語で幅を超える場合は文字単位で折り返す
+				for _, ch := range word {
+					cw := measureRunes(font, []rune{ch}, lastRune(line.runes))
+					if line.width+cw > width && len(line.runes) > 0 {
+						lines = append(lines, line)
+						line = textLine{}
+						cw = font.advance(ch)
+					}
+					line.runes = append(line.runes, ch)
+					line.width += cw
+				}
+				continue
+			}
+			line.runes = append(line.runes, word...)
+			line.width += w
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitWordsは、文字列を単語・空白・CJKの一文字ごとに分割します
+func splitWords(s string) [][]rune {
+	var words [][]rune
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, word)
+			word = nil
+		}
+	}
+	for _, ch := range s {
+		switch {
+		case unicode.IsSpace(ch) || isCJK(ch):
+			flush()
+			words = append(words, []rune{ch})
+		default:
+			word = append(word, ch)
+		}
+	}
+	flush()
+	return words
+}
+
+// isCJKは、文字単位で折り返してよい文字か否かを判定します
+func isCJK(ch rune) bool {
+	return unicode.In(ch, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(ch >= 0x3000 && ch <= 0x303f) || (ch >= 0xff00 && ch <= 0xffef)
+}
+
+// measureRunesは、直前の文字prevに続けて書いた場合の文字列の幅を返します
+func measureRunes(font textFont, runes []rune, prev rune) int32 {
+	var w int32
+	for _, ch := range runes {
+		if prev != 0 {
+			w += font.kerning(prev, ch)
+		}
+		w += font.advance(ch)
+		prev = ch
+	}
+	return w
+}
+
+// trimLineは、行末の空白を取り除きます
+func trimLine(font textFont, line textLine) textLine {
+	for len(line.runes) > 0 && unicode.IsSpace(line.runes[len(line.runes)-1]) {
+		line.width -= font.advance(line.runes[len(line.runes)-1])
+		line.runes = line.runes[:len(line.runes)-1]
+	}
+	return line
+}
+
+// lastRuneは、最後の文字を返します（空なら0）
+func lastRune(runes []rune) rune {
+	if len(runes) == 0 {
+		return 0
+	}
+	return runes[len(runes)-1]
+}
+
+/*
+textLayoutは、書き出し位置を決めた文字列です。
+*/
+type textLayout struct {
+	font  textFont
+	text  data.Text
+	lines []textLine
+	rect  data.Rect     // 書き出し先の矩形
+	top   int32         // 一行目の上端
+	alpha uint8         // スプライトの不透明度
+	mod   data.Color    // スプライトの色の乗算
+	blend sdl.BlendMode // スプライトの合成方法
+}
+
+/*
+drawTextは、文字列のスプライトを書き出します。
+影、縁取り、本体の順に重ねて書き出します。
+*/
+func (renderer *Renderer) drawText(sprite *data.Sprite) error {
+	text := sprite.Text
+	font, ok := renderer.fonts[text.FontID]
+	if !ok {
+		return errors.New(fmt.Sprintf("Unknown Font:%d", text.FontID))
+	}
+	// 文字列は小数の位置を丸めて書き出す
+	rect := sprite.DistRect
+	left, top, _, _ := spriteOrigin(sprite)
+	rect.Left, rect.Top = int32(math.Round(left)), int32(math.Round(top))
+	rect.Left -= renderer.origin.X
+	rect.Top -= renderer.origin.Y
+	layout := textLayout{
+		font:  font,
+		text:  text,
+		lines: layoutText(font, text.Content, sprite.DistRect.Width, text.Wrap),
+		rect:  rect,
+		top:   rect.Top,
+		alpha: sprite.Alpha,
+		mod:   sprite.ColorMod,
+		blend: sdlBlendMode(sprite.Blend),
+	}
+	// 縦方向の揃え
+	height := (font.lineHeight()+text.LineSpacing)*int32(len(layout.lines)) - text.LineSpacing
+	switch text.VerticalAlign {
+	case data.AlignMiddle:
+		layout.top += (layout.rect.Height - height) / 2
+	case data.AlignBottom:
+		layout.top += layout.rect.Height - height
+	}
+
+	if text.ShadowX != 0 || text.ShadowY != 0 {
+		if err := renderer.drawTextLayout(&layout, text.ShadowX, text.ShadowY, text.ShadowColor); err != nil {
+			return err
+		}
+	}
+	if r := text.Outline; r > 0 {
+		for _, d := range [][2]int32{{-r, -r}, {0, -r}, {r, -r}, {-r, 0}, {r, 0}, {-r, r}, {0, r}, {r, r}} {
+			if err := renderer.drawTextLayout(&layout, d[0], d[1], text.OutlineColor); err != nil {
+				return err
+			}
+		}
+	}
+	return renderer.drawTextLayout(&layout, 0, 0, text.Color)
+}
+
+/*
+drawTextLayoutは、文字列を(dx, dy)だけずらして指定した色で一回書き出します。
+*/
+func (renderer *Renderer) drawTextLayout(layout *textLayout, dx, dy int32, color data.Color) error {
+	font := layout.font
+	a := mulColor(color.A, layout.alpha)
+	r, g, b := mulColor(color.R, layout.mod.R), mulColor(color.G, layout.mod.G), mulColor(color.B, layout.mod.B)
+	lh := font.lineHeight() + layout.text.LineSpacing
+	for i, line := range layout.lines {
+		x := layout.rect.Left + dx
+		switch layout.text.Align {
+		case data.AlignCenter:
+			x += (layout.rect.Width - line.width) / 2
+		case data.AlignRight:
+			x += layout.rect.Width - line.width
+		}
+		y := layout.top + lh*int32(i) + dy
+		var prev rune
+		for _, ch := range line.runes {
+			if prev != 0 {
+				x += font.kerning(prev, ch)
+			}
+			prev = ch
+			if !unicode.IsSpace(ch) {
+				gl, err := font.glyph(renderer.SdlRenderer, ch)
+				if err != nil {
+					return err
+				}
+				if gl == nil {
+					x += font.advance(ch)
+					continue
+				}
+				gl.texture.SetColorMod(r, g, b)
+				gl.texture.SetAlphaMod(a)
+				gl.texture.SetBlendMode(layout.blend)
+				dist := sdl.Rect{X: x + gl.offsetX, Y: y + gl.offsetY, W: gl.src.W, H: gl.src.H}
+				renderer.countDraw(gl.texture)
+				if err := renderer.SdlRenderer.Copy(gl.texture, &gl.src, &dist); err != nil {
+					return err
+				}
+			}
+			x += font.advance(ch)
+		}
+	}
+	return nil
+}
+
+// mulColorは、0〜255の値同士を乗算します
+func mulColor(a, b uint8) uint8 {
+	return uint8(uint16(a) * uint16(b) / 255)
+}
@@ -0,0 +1,88 @@
+package pilot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// monoFontは、全ての文字が幅10の試験用フォントです
+type monoFont struct{}
+
+func (monoFont) glyph(renderer *sdl.Renderer, ch rune) (*glyph, error) { return nil, nil }
+func (monoFont) advance(ch rune) int32                                 { return 10 }
+func (monoFont) kerning(prev, ch rune) int32                           { return 0 }
+func (monoFont) lineHeight() int32                                     { return 16 }
+
+func TestLayoutTextWrap(t *testing.T) {
+	cases := []struct {
+		content string
+		width   int32
+		want    []string
+	}{
+		{"hello world", 200, []string{"hello world"}},
+		{"hello world", 60, []string{"hello", "world"}},
+		{"abcdefgh", 30, []string{"abc", "def", "gh"}},
+		{"あいうえお", 30, []string{"あいう", "えお"}},
+		{"one\ntwo", 200, []string{"one", "two"}},
+	}
+	for _, c := range cases {
+		lines := layoutText(monoFont{}, c.content, c.width, true)
+		var got []string
+		for _, l := range lines {
+			got = append(got, string(l.runes))
+			if l.width > c.width {
+				t.Errorf("%q: line %q exceeds width %d", c.content, string(l.runes), c.width)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("%q: want %v, got %v", c.content, c.want, got)
+		}
+	}
+}
+
+func TestParseBMFont(t *testing.T) {
+	src := `info face="Pixel Font" size=16
+common lineHeight=18 base=14 scaleW=128 scaleH=128 pages=1
+page id=0 file="pixel_0.png"
+char id=65 x=2 y=3 width=8 height=12 xoffset=1 yoffset=2 xadvance=9 page=0 chnl=15
+kerning first=65 second=86 amount=-1
+`
+	desc, err := parseBMFont(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.lineHeight != 18 || desc.pages[0] != "pixel_0.png" {
+		t.Errorf("common/page: %+v", desc)
+	}
+	if len(desc.chars) != 1 || desc.chars[0].rect.W != 8 || desc.chars[0].advance != 9 {
+		t.Errorf("char: %+v", desc.chars)
+	}
+	if desc.kernings[[2]rune{'A', 'V'}] != -1 {
+		t.Errorf("kerning: %v", desc.kernings)
+	}
+}
+
+func TestBitmapFontMissingGlyph(t *testing.T) {
+	question := &glyph{src: sdl.Rect{W: 6, H: 12}}
+	font := &bitmapFont{
+		glyphs:   map[rune]*glyph{'A': {src: sdl.Rect{W: 8, H: 12}}, '?': question},
+		advances: map[rune]int32{'A': 9, '?': 7},
+	}
+	// フォントに無い文字は「?」で代用する
+	g, err := font.glyph(nil, 'あ')
+	if err != nil || g != question || font.advance('あ') != 7 {
+		t.Errorf("fallback: %v %v %d", g, err, font.advance('あ'))
+	}
+	// 「?」も無い場合は書き出さずに進む
+	delete(font.glyphs, '?')
+	delete(font.advances, '?')
+	g, err = font.glyph(nil, 'あ')
+	if err != nil || g != nil || font.advance('あ') != 0 {
+		t.Errorf("no fallback: %v %v %d", g, err, font.advance('あ'))
+	}
+	if g, _ := font.glyph(nil, 'A'); g == nil || font.advance('A') != 9 {
+		t.Errorf("existing glyph: %v %d", g, font.advance('A'))
+	}
+}
@@ -0,0 +1,228 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// モザイクの一辺の初期値
+const defaultMosaicBlock = 32
+
+/*
+transitionStateは、実行中の画面効果の状態です。
+*/
+type transitionState struct {
+	transition data.Transition
+	from       *sdl.Texture // 開始した時点の画面
+	work       *sdl.Texture // モザイクの縮小に使う作業用の画面
+	elapsed    uint32       // 経過時間（ミリ秒）
+}
+
+/*
+StartTransitionは、現在表示している画面を保存し、場面を切り替える画面効果を開始します。
+実行中の画面効果は、完了のイベントを送らずに中断します。
+*/
+func (renderer *Renderer) StartTransition(transition data.Transition) error {
+	renderer.stopTransition()
+	from, err := renderer.createTargetTexture(renderer.logicalW, renderer.logicalH, FilterNearest)
+	if err != nil {
+		return err
+	}
+	state := transitionState{transition: transition, from: from}
+	renderer.transition = &state
+	if transition.Type == data.TransitionMosaic {
+		if state.work, err = renderer.createTargetTexture(renderer.logicalW, renderer.logicalH, FilterNearest); err != nil {
+			renderer.stopTransition()
+			return err
+		}
+	}
+	// 直前に書き出した画面を写し取る
+	if err = renderer.SdlRenderer.SetRenderTarget(from); err != nil {
+		renderer.stopTransition()
+		return err
+	}
+	renderer.screen.SetBlendMode(sdl.BLENDMODE_NONE)
+	defer renderer.screen.SetBlendMode(sdl.BLENDMODE_BLEND)
+	if err = renderer.SdlRenderer.Copy(renderer.screen, nil, nil); err != nil {
+		renderer.stopTransition()
+		return err
+	}
+	return nil
+}
+
+/*
+stopTransitionは、実行中の画面効果を中断し、テクスチャを破棄します。
+*/
+func (renderer *Renderer) stopTransition() {
+	state := renderer.transition
+	if state == nil {
+		return
+	}
+	if state.from != nil {
+		state.from.Destroy()
+	}
+	if state.work != nil {
+		state.work.Destroy()
+	}
+	renderer.transition = nil
+}
+
+/*
+updateTransitionは、画面効果をdeltaミリ秒進めます。終了した場合は完了のイベントを送信待ちにします。
+*/
+func (renderer *Renderer) updateTransition(delta uint32) {
+	state := renderer.transition
+	if state == nil {
+		return
+	}
+	state.elapsed += delta
+	if state.elapsed >= state.transition.Duration {
+		renderer.stopTransition()
+		renderer.pushEvent(data.Event{Device: data.DeviceRenderer, Code: data.TransitionEnd})
+	}
+}
+
+/*
+drawTransitionは、次の場面を重ね終えた画面に、前の画面を進行度に応じて重ねます。
+書き出し先は論理解像度の画面である必要があります。
+*/
+func (renderer *Renderer) drawTransition() error {
+	state := renderer.transition
+	if state == nil {
+		return nil
+	}
+	transition := state.transition
+	p := 1.0
+	if transition.Duration > 0 {
+		p = float64(state.elapsed) / float64(transition.Duration)
+	}
+	p = clamp01(ease(transition.Easing, clamp01(p)))
+	w, h := renderer.logicalW, renderer.logicalH
+	from := state.from
+	from.SetColorMod(255, 255, 255)
+	from.SetAlphaMod(255)
+	from.SetBlendMode(sdl.BLENDMODE_BLEND)
+
+	switch transition.Type {
+	case data.TransitionFade:
+		// 前半は前の画面を、後半は次の画面を指定した色で覆う
+		cover := 1 - math.Abs(2*p-1)
+		if p < 0.5 {
+			if err := renderer.SdlRenderer.Copy(from, nil, nil); err != nil {
+				return err
+			}
+		}
+		c := transition.Color
+		renderer.SdlRenderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+		renderer.SdlRenderer.SetDrawColor(c.R, c.G, c.B, uint8(math.Round(255*cover)))
+		return renderer.SdlRenderer.FillRect(nil)
+	case data.TransitionCrossfade:
+		from.SetAlphaMod(uint8(math.Round(255 * (1 - p))))
+		return renderer.SdlRenderer.Copy(from, nil, nil)
+	case data.TransitionWipe:
+		rect := wipeRect(transition.Direction, w, h, p)
+		if rect.Empty() {
+			return nil
+		}
+		return renderer.SdlRenderer.Copy(from, &rect, &rect)
+	case data.TransitionIris:
+		for _, rect := range irisSpans(w, h, p) {
+			r := rect
+			if err := renderer.SdlRenderer.Copy(from, &r, &r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case data.TransitionMosaic:
+		return renderer.drawMosaic(state, p)
+	}
+	return nil
+}
+
+/*
+drawMosaicは、前半は前の画面を、後半は次の画面を粗くして書き出します。
+縮小した画面を補間せずに拡大することで、モザイクにします。
+*/
+func (renderer *Renderer) drawMosaic(state *transitionState, p float64) error {
+	maxBlock := state.transition.BlockSize
+	if maxBlock <= 0 {
+		maxBlock = defaultMosaicBlock
+	}
+	block := int32(math.Round(1 + float64(maxBlock-1)*(1-math.Abs(2*p-1))))
+	src := renderer.screen
+	if p < 0.5 {
+		src = state.from
+	}
+	if block <= 1 {
+		if src == renderer.screen {
+			return nil
+		}
+		return renderer.SdlRenderer.Copy(src, nil, nil)
+	}
+	w, h := renderer.logicalW, renderer.logicalH
+	small := sdl.Rect{W: (w + block - 1) / block, H: (h + block - 1) / block}
+	// 作業用の画面に縮小する
+	if err := renderer.SdlRenderer.SetRenderTarget(state.work); err != nil {
+		return err
+	}
+	src.SetBlendMode(sdl.BLENDMODE_NONE)
+	err := renderer.SdlRenderer.Copy(src, nil, &small)
+	src.SetBlendMode(sdl.BLENDMODE_BLEND)
+	if err != nil {
+		return err
+	}
+	// 画面に拡大して戻す
+	if err := renderer.SdlRenderer.SetRenderTarget(renderer.screen); err != nil {
+		return err
+	}
+	state.work.SetBlendMode(sdl.BLENDMODE_NONE)
+	defer state.work.SetBlendMode(sdl.BLENDMODE_BLEND)
+	dst := sdl.Rect{W: small.W * block, H: small.H * block}
+	return renderer.SdlRenderer.Copy(state.work, &small, &dst)
+}
+
+/*
+wipeRectは、拭き取りの進行度pにおいて、前の画面が残っている範囲を返します。
+*/
+func wipeRect(direction data.WipeDirection, w, h int32, p float64) sdl.Rect {
+	dw := int32(math.Round(float64(w) * p))
+	dh := int32(math.Round(float64(h) * p))
+	switch direction {
+	case data.WipeToLeft:
+		return sdl.Rect{X: 0, Y: 0, W: w - dw, H: h}
+	case data.WipeToDown:
+		return sdl.Rect{X: 0, Y: dh, W: w, H: h - dh}
+	case data.WipeToUp:
+		return sdl.Rect{X: 0, Y: 0, W: w, H: h - dh}
+	}
+	return sdl.Rect{X: dw, Y: 0, W: w - dw, H: h}
+}
+
+/*
+irisSpansは、中央から広がる円の外側（前の画面が残っている範囲）を横方向の矩形に分解して返します。
+円の半径は、進行度1で画面の四隅に届く大きさです。
+*/
+func irisSpans(w, h int32, p float64) []sdl.Rect {
+	cx, cy := float64(w)/2, float64(h)/2
+	r := math.Hypot(cx, cy) * p
+	spans := make([]sdl.Rect, 0, 2*h)
+	for y := int32(0); y < h; y++ {
+		dy := float64(y) + 0.5 - cy
+		if math.Abs(dy) >= r {
+			spans = append(spans, sdl.Rect{X: 0, Y: y, W: w, H: 1})
+			continue
+		}
+		dx := math.Sqrt(r*r - dy*dy)
+		left := int32(math.Max(0, math.Round(cx-dx)))
+		right := int32(math.Min(float64(w), math.Round(cx+dx)))
+		if left > 0 {
+			spans = append(spans, sdl.Rect{X: 0, Y: y, W: left, H: 1})
+		}
+		if right < w {
+			spans = append(spans, sdl.Rect{X: right, Y: y, W: w - right, H: 1})
+		}
+	}
+	return spans
+}
@@ -0,0 +1,92 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestWipeRect(t *testing.T) {
+	cases := []struct {
+		direction data.WipeDirection
+		p         float64
+		want      sdl.Rect
+	}{
+		{data.WipeToRight, 0, sdl.Rect{X: 0, Y: 0, W: 320, H: 240}},
+		{data.WipeToRight, 0.25, sdl.Rect{X: 80, Y: 0, W: 240, H: 240}},
+		{data.WipeToLeft, 0.25, sdl.Rect{X: 0, Y: 0, W: 240, H: 240}},
+		{data.WipeToDown, 0.5, sdl.Rect{X: 0, Y: 120, W: 320, H: 120}},
+		{data.WipeToUp, 0.5, sdl.Rect{X: 0, Y: 0, W: 320, H: 120}},
+		{data.WipeToUp, 1, sdl.Rect{X: 0, Y: 0, W: 320, H: 0}},
+	}
+	for _, c := range cases {
+		if got := wipeRect(c.direction, 320, 240, c.p); got != c.want {
+			t.Errorf("direction %d at %v: want %+v, got %+v", c.direction, c.p, c.want, got)
+		}
+	}
+}
+
+func TestIrisSpans(t *testing.T) {
+	const w, h = 40, 30
+	// 始まりは画面全体、終わりは何も残らない
+	spans := irisSpans(w, h, 0)
+	if len(spans) != h {
+		t.Fatalf("start: %d spans", len(spans))
+	}
+	for _, s := range spans {
+		if s.X != 0 || s.W != w || s.H != 1 {
+			t.Errorf("start span %+v", s)
+		}
+	}
+	if spans := irisSpans(w, h, 1); len(spans) != 0 {
+		t.Errorf("end: %v", spans)
+	}
+	// 途中では、中央を含む行に円の左右の帯が残り、円は中央から左右対称に広がる
+	spans = irisSpans(w, h, 0.5)
+	var left, right *sdl.Rect
+	for i := range spans {
+		s := &spans[i]
+		if s.Y != h/2 {
+			continue
+		}
+		if s.X == 0 {
+			left = s
+		} else {
+			right = s
+		}
+	}
+	if left == nil || right == nil || left.W != w-right.X || left.W <= 0 || right.X >= w {
+		t.Errorf("middle row: left %+v right %+v", left, right)
+	}
+	// 残る範囲は進行に合わせて狭くなる
+	area := func(spans []sdl.Rect) int32 {
+		var a int32
+		for _, s := range spans {
+			a += s.W * s.H
+		}
+		return a
+	}
+	if a, b := area(irisSpans(w, h, 0.3)), area(irisSpans(w, h, 0.6)); a <= b {
+		t.Errorf("area should shrink: %d then %d", a, b)
+	}
+}
+
+func TestUpdateTransitionEnd(t *testing.T) {
+	renderer := &Renderer{}
+	renderer.transition = &transitionState{transition: data.Transition{Type: data.TransitionWipe, Duration: 100}}
+	renderer.updateTransition(60)
+	if renderer.transition == nil || len(renderer.TakeEvents()) != 0 {
+		t.Fatal("transition ended early")
+	}
+	// Durationに達したフレームで終了し、完了のイベントを一度だけ送る
+	renderer.updateTransition(40)
+	events := renderer.TakeEvents()
+	if renderer.transition != nil || len(events) != 1 || events[0].Code != data.TransitionEnd {
+		t.Errorf("end: %v %+v", renderer.transition, events)
+	}
+	renderer.updateTransition(40)
+	if len(renderer.TakeEvents()) != 0 {
+		t.Error("end event sent twice")
+	}
+}
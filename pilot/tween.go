@@ -0,0 +1,260 @@
+package pilot
+
+import (
+	"math"
+
+	"github.com/collabologic/theater/data"
+)
+
+/*
+tweenStateは、実行中のTweenの進行状態です。
+*/
+type tweenState struct {
+	tween   *data.Tween
+	from    float64 // 実際の開始値
+	started bool    // Delayを過ぎて変化を始めたか否か
+	elapsed uint32  // Delayを含めた経過時間（ミリ秒）
+}
+
+/*
+tweenEntryは、一つのスプライトに対して実行中のTweenの一覧です。
+*/
+type tweenEntry struct {
+	states []*tweenState
+}
+
+/*
+newTweenEntryは、スプライトに設定されたTweenから実行状態を作成します。
+*/
+func newTweenEntry(sprite *data.Sprite) *tweenEntry {
+	entry := tweenEntry{}
+	for i := range sprite.Tweens {
+		entry.states = append(entry.states, &tweenState{tween: &sprite.Tweens[i]})
+	}
+	return &entry
+}
+
+/*
+UpdateTweensは、前回の呼び出しからの経過時間（ミリ秒）だけTweenを進め、スプライトに反映します。
+親を持つスプライトの場合は、親を基準とした値を変化させます。
+Pilotのフレームごとに呼び出されます。
+*/
+func (renderer *Renderer) UpdateTweens(delta uint32) {
+	for id, entry := range renderer.tweens {
+		sprite, ok := renderer.findSprite(id)
+		if !ok {
+			delete(renderer.tweens, id)
+			continue
+		}
+		renderer.markSpriteDirty(sprite)
+		running := entry.states[:0]
+		for _, state := range entry.states {
+			if !state.step(renderer.localSprite(sprite), delta) {
+				running = append(running, state)
+			} else if state.tween.Next != nil {
+				running = append(running, &tweenState{tween: state.tween.Next})
+			}
+		}
+		entry.states = running
+		renderer.indexSprite(sprite)
+		renderer.markSpriteDirty(sprite)
+		if len(entry.states) == 0 {
+			delete(renderer.tweens, id)
+		}
+	}
+}
+
+/*
+stepはTweenをdeltaミリ秒進めてスプライトに値を書き込みます。終了した場合はtrueを返します。
+*/
+func (state *tweenState) step(sprite *data.Sprite, delta uint32) bool {
+	tween := state.tween
+	state.elapsed += delta
+	if state.elapsed < tween.Delay {
+		return false
+	}
+	if !state.started {
+		state.started = true
+		state.from = tween.From
+		if tween.FromCurrent {
+			state.from = getTweenProperty(sprite, tween.Property)
+		}
+	}
+	cycle := tween.Duration
+	if tween.Yoyo {
+		cycle *= 2
+	}
+	t := state.elapsed - tween.Delay
+	if cycle == 0 || (tween.Repeat >= 0 && t/cycle > uint32(tween.Repeat)) {
+		// 終了時の値に揃える
+		if tween.Yoyo {
+			setTweenProperty(sprite, tween.Property, state.from)
+		} else {
+			setTweenProperty(sprite, tween.Property, tween.To)
+		}
+		return true
+	}
+	pos := t % cycle
+	var progress float64
+	if tween.Yoyo && pos >= tween.Duration {
+		progress = 1 - float64(pos-tween.Duration)/float64(tween.Duration)
+	} else {
+		progress = float64(pos) / float64(tween.Duration)
+	}
+	value := state.from + (tween.To-state.from)*ease(tween.Easing, progress)
+	setTweenProperty(sprite, tween.Property, value)
+	return false
+}
+
+// getTweenPropertyは、スプライトのプロパティの現在値を取得します
+func getTweenProperty(sprite *data.Sprite, property data.TweenProperty) float64 {
+	switch property {
+	case data.TweenX:
+		return sprite.Position().X
+	case data.TweenY:
+		return sprite.Position().Y
+	case data.TweenWidth:
+		return float64(sprite.DistRect.Width)
+	case data.TweenHeight:
+		return float64(sprite.DistRect.Height)
+	case data.TweenAngle:
+		return sprite.Rotate.Angle
+	case data.TweenAlpha:
+		return float64(sprite.Alpha)
+	case data.TweenScale, data.TweenScaleX:
+		return sprite.ScaleX
+	case data.TweenScaleY:
+		return sprite.ScaleY
+	}
+	return 0
+}
+
+// setTweenPropertyは、スプライトのプロパティに値を設定します
+func setTweenProperty(sprite *data.Sprite, property data.TweenProperty, value float64) {
+	switch property {
+	case data.TweenX:
+		// 位置は小数部分まで変化させて滑らかに動かす
+		sprite.SetPosition(value, sprite.Position().Y)
+	case data.TweenY:
+		sprite.SetPosition(sprite.Position().X, value)
+	case data.TweenWidth:
+		sprite.DistRect.Width = int32(math.Round(value))
+	case data.TweenHeight:
+		sprite.DistRect.Height = int32(math.Round(value))
+	case data.TweenAngle:
+		sprite.Rotate.Angle = value
+	case data.TweenAlpha:
+		sprite.Alpha = uint8(math.Max(0, math.Min(255, math.Round(value))))
+	case data.TweenScale:
+		sprite.ScaleX = value
+		sprite.ScaleY = value
+	case data.TweenScaleX:
+		sprite.ScaleX = value
+	case data.TweenScaleY:
+		sprite.ScaleY = value
+	}
+}
+
+/*
+easeは、進行度t（0〜1）にイージングを適用した値を返します。
+*/
+func ease(easing data.Easing, t float64) float64 {
+	const (
+		back    = 1.70158
+		backIO  = back * 1.525
+		elastic = 2 * math.Pi / 3
+	)
+	switch easing {
+	case data.EaseInQuad:
+		return t * t
+	case data.EaseOutQuad:
+		return 1 - (1-t)*(1-t)
+	case data.EaseInOutQuad:
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 2)/2
+	case data.EaseInCubic:
+		return t * t * t
+	case data.EaseOutCubic:
+		return 1 - math.Pow(1-t, 3)
+	case data.EaseInOutCubic:
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 3)/2
+	case data.EaseInSine:
+		return 1 - math.Cos(t*math.Pi/2)
+	case data.EaseOutSine:
+		return math.Sin(t * math.Pi / 2)
+	case data.EaseInOutSine:
+		return -(math.Cos(math.Pi*t) - 1) / 2
+	case data.EaseInExpo:
+		if t == 0 {
+			return 0
+		}
+		return math.Pow(2, 10*t-10)
+	case data.EaseOutExpo:
+		if t == 1 {
+			return 1
+		}
+		return 1 - math.Pow(2, -10*t)
+	case data.EaseInOutExpo:
+		switch {
+		case t == 0, t == 1:
+			return t
+		case t < 0.5:
+			return math.Pow(2, 20*t-10) / 2
+		}
+		return (2 - math.Pow(2, -20*t+10)) / 2
+	case data.EaseInBack:
+		return (back+1)*t*t*t - back*t*t
+	case data.EaseOutBack:
+		return 1 + (back+1)*math.Pow(t-1, 3) + back*math.Pow(t-1, 2)
+	case data.EaseInOutBack:
+		if t < 0.5 {
+			return math.Pow(2*t, 2) * ((backIO+1)*2*t - backIO) / 2
+		}
+		return (math.Pow(2*t-2, 2)*((backIO+1)*(t*2-2)+backIO) + 2) / 2
+	case data.EaseInElastic:
+		if t == 0 || t == 1 {
+			return t
+		}
+		return -math.Pow(2, 10*t-10) * math.Sin((t*10-10.75)*elastic)
+	case data.EaseOutElastic:
+		if t == 0 || t == 1 {
+			return t
+		}
+		return math.Pow(2, -10*t)*math.Sin((t*10-0.75)*elastic) + 1
+	case data.EaseInBounce:
+		return 1 - bounce(1-t)
+	case data.EaseOutBounce:
+		return bounce(t)
+	case data.EaseInOutBounce:
+		if t < 0.5 {
+			return (1 - bounce(1-2*t)) / 2
+		}
+		return (1 + bounce(2*t-1)) / 2
+	}
+	return t
+}
+
+// bounceは、跳ねながら減速するイージングです
+func bounce(t float64) float64 {
+	const (
+		n = 7.5625
+		d = 2.75
+	)
+	switch {
+	case t < 1/d:
+		return n * t * t
+	case t < 2/d:
+		t -= 1.5 / d
+		return n*t*t + 0.75
+	case t < 2.5/d:
+		t -= 2.25 / d
+		return n*t*t + 0.9375
+	}
+	t -= 2.625 / d
+	return n*t*t + 0.984375
+}
@@ -0,0 +1,45 @@
+package pilot
+
+import (
+	"math"
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestEaseEndpoints(t *testing.T) {
+	for e := data.Linear; e <= data.EaseInOutBounce; e++ {
+		if v := ease(e, 0); math.Abs(v) > 1e-9 {
+			t.Errorf("easing %d: ease(0) = %f", e, v)
+		}
+		if v := ease(e, 1); math.Abs(v-1) > 1e-9 {
+			t.Errorf("easing %d: ease(1) = %f", e, v)
+		}
+	}
+}
+
+func TestTweenStep(t *testing.T) {
+	sprite := data.NewSprite(0)
+	tween := data.Tween{
+		Property: data.TweenX,
+		From:     0,
+		To:       100,
+		Duration: 1000,
+		Delay:    500,
+		Yoyo:     true,
+	}
+	state := tweenState{tween: &tween}
+
+	if state.step(&sprite, 400) || sprite.DistRect.Left != 0 {
+		t.Errorf("moved during delay: %d", sprite.DistRect.Left)
+	}
+	if state.step(&sprite, 600) || sprite.DistRect.Left != 50 {
+		t.Errorf("halfway: want 50, got %d", sprite.DistRect.Left)
+	}
+	if state.step(&sprite, 1000) || sprite.DistRect.Left != 50 {
+		t.Errorf("yoyo halfway back: want 50, got %d", sprite.DistRect.Left)
+	}
+	if !state.step(&sprite, 500) || sprite.DistRect.Left != 0 {
+		t.Errorf("finished: want 0, got %d", sprite.DistRect.Left)
+	}
+}
@@ -0,0 +1,179 @@
+package pilot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/collabologic/theater/data"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+/*
+viewportStateは、ビューポートの設定と書き出し先の画像です。
+*/
+type viewportState struct {
+	viewport data.Viewport
+	texture  *sdl.Texture // ビューポートの画像（画面の範囲の大きさ）
+	layer    *sdl.Texture // レイヤーを一枚ずつ書き出す作業用の画像（画面の範囲の大きさ）
+}
+
+// destroyは、ビューポートの画像を破棄します
+func (state *viewportState) destroy() {
+	state.texture.Destroy()
+	state.layer.Destroy()
+}
+
+/*
+SetViewportは、ビューポートを追加・更新します。
+ビューポートを一つでも設定すると、画面にはレイヤーをそのまま重ねる代わりに、ビューポートをIDの順に重ねます。
+画面の範囲の大きさが変わる場合のみ、書き出し先の画像を作り直します。
+*/
+func (renderer *Renderer) SetViewport(id data.ViewportIdentifier, viewport data.Viewport) error {
+	camera, screen := viewport.Camera, viewport.Screen
+	if camera.Width <= 0 || camera.Height <= 0 || screen.Width <= 0 || screen.Height <= 0 {
+		return errors.New(fmt.Sprintf("Invalid viewport size:%d", id))
+	}
+	// 設定は呼び出し元と共有しない
+	viewport.Layers = append([]data.LayerIdentifier(nil), viewport.Layers...)
+	state, ok := renderer.viewports[id]
+	if ok && state.viewport.Screen.Width == screen.Width && state.viewport.Screen.Height == screen.Height {
+		state.viewport = viewport
+		return nil
+	}
+	texture, err := renderer.createTargetTexture(screen.Width, screen.Height, renderer.scaleFilter)
+	if err != nil {
+		return err
+	}
+	layer, err := renderer.createTargetTexture(screen.Width, screen.Height, FilterNearest)
+	if err != nil {
+		texture.Destroy()
+		return err
+	}
+	if ok {
+		state.destroy()
+	}
+	renderer.viewports[id] = &viewportState{viewport: viewport, texture: texture, layer: layer}
+	return nil
+}
+
+/*
+RemoveViewportは、ビューポートを削除します。全て削除すると、画面にはレイヤーをそのまま重ねるようになります。
+*/
+func (renderer *Renderer) RemoveViewport(id data.ViewportIdentifier) {
+	state, ok := renderer.viewports[id]
+	if !ok {
+		return
+	}
+	state.destroy()
+	delete(renderer.viewports, id)
+}
+
+/*
+Viewportは、ビューポートの設定を返します。
+*/
+func (renderer *Renderer) Viewport(id data.ViewportIdentifier) (data.Viewport, bool) {
+	state, ok := renderer.viewports[id]
+	if !ok {
+		return data.Viewport{}, false
+	}
+	return state.viewport, true
+}
+
+// viewportIDsは、ビューポートのIDを昇順にソートして返却します
+func (renderer *Renderer) viewportIDs() []data.ViewportIdentifier {
+	ids := make([]data.ViewportIdentifier, 0, len(renderer.viewports))
+	for id := range renderer.viewports {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+/*
+drawViewportsは、ビューポートごとに、カメラの範囲のレイヤーをビューポートの画像に書き出します。
+ビューポートはカメラがフレームごとに動くため、書き直しが必要な範囲を使わずに毎回全体を書き出します。
+*/
+func (renderer *Renderer) drawViewports(layerIDs []data.LayerIdentifier) error {
+	defer func() {
+		renderer.origin = sdl.Point{}
+	}()
+	for _, id := range renderer.viewportIDs() {
+		if err := renderer.drawViewport(renderer.viewports[id], layerIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+drawViewportは、ビューポートが書き出すレイヤーを一枚ずつ作業用の画像に書き出し、
+レイヤーの設定を適用してビューポートの画像に重ねます。
+スプライトはカメラと画面の範囲の大きさの比で拡大・縮小して書き出すため、縮小した画面でも細部が潰れません。
+*/
+func (renderer *Renderer) drawViewport(state *viewportState, layerIDs []data.LayerIdentifier) error {
+	viewport := &state.viewport
+	camera := *viewport.Camera.ToSdlRect()
+	scaleX := float32(viewport.Screen.Width) / float32(camera.W)
+	scaleY := float32(viewport.Screen.Height) / float32(camera.H)
+	if err := renderer.SdlRenderer.SetRenderTarget(state.texture); err != nil {
+		return err
+	}
+	c := viewport.Background
+	renderer.SdlRenderer.SetDrawColor(c.R, c.G, c.B, c.A)
+	if err := renderer.SdlRenderer.Clear(); err != nil {
+		return err
+	}
+	for _, id := range layerIDs {
+		property := renderer.layerProperties[id]
+		if !viewport.Contains(id) || property.Hidden || property.Alpha == 0 {
+			continue
+		}
+		if err := renderer.SdlRenderer.SetRenderTarget(state.layer); err != nil {
+			return err
+		}
+		renderer.SdlRenderer.SetDrawColor(0, 0, 0, 0)
+		if err := renderer.SdlRenderer.Clear(); err != nil {
+			return err
+		}
+		if err := renderer.SdlRenderer.SetScale(scaleX, scaleY); err != nil {
+			return err
+		}
+		renderer.origin = sdl.Point{X: camera.X, Y: camera.Y}
+		renderer.lastTexture = nil
+		sprites := renderer.visibleSprites(id, camera)
+		err := renderer.drawBatched(sprites)
+		renderer.origin = sdl.Point{}
+		renderer.SdlRenderer.SetScale(1, 1)
+		if err != nil {
+			return err
+		}
+		renderer.frameDraw.Layers++
+		renderer.frameDraw.Drawn += len(sprites)
+		renderer.frameDraw.Culled += len(renderer.Layers[id]) - len(sprites)
+		if err := renderer.SdlRenderer.SetRenderTarget(state.texture); err != nil {
+			return err
+		}
+		// 表示する範囲は画面全体を前提とするため、ビューポートでは使わない
+		property.Clip = data.Rect{}
+		if err := renderer.compositeLayer(state.layer, property); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+compositeViewportsは、ビューポートの画像をIDの順に画面の指定の範囲に重ねます。
+*/
+func (renderer *Renderer) compositeViewports() error {
+	for _, id := range renderer.viewportIDs() {
+		state := renderer.viewports[id]
+		if err := renderer.SdlRenderer.Copy(state.texture, nil, state.viewport.Screen.ToSdlRect()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
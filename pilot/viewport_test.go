@@ -0,0 +1,40 @@
+package pilot
+
+import (
+	"testing"
+
+	"github.com/collabologic/theater/data"
+)
+
+func TestViewportToCamera(t *testing.T) {
+	// 右半分の画面に、(1000, 500)からの倍の範囲を縮小して書き出すビューポート
+	viewport := data.NewViewport(
+		data.Rect{Left: 1000, Top: 500, Width: 320, Height: 480},
+		data.Rect{Left: 160, Top: 0, Width: 160, Height: 240},
+	)
+	x, y, ok := viewport.ToCamera(160.5, 10.5)
+	if !ok || x != 1001 || y != 521 {
+		t.Errorf("inside: %v %v %v", x, y, ok)
+	}
+	for _, p := range [][2]float64{{159.5, 10}, {320, 10}, {200, 240}, {200, -0.5}} {
+		if _, _, ok := viewport.ToCamera(p[0], p[1]); ok {
+			t.Errorf("outside %v: ok", p)
+		}
+	}
+	// 画面の座標に戻す変換は、ビューポートの外の座標もそのまま変換する
+	if sx, sy := viewport.ToScreen(1001, 521); sx != 160.5 || sy != 10.5 {
+		t.Errorf("to screen: %v %v", sx, sy)
+	}
+	view := debugView{viewport: &viewport}
+	if p := view.toScreen(fpoint{900, 500}); p.X != 110 || p.Y != 0 {
+		t.Errorf("debug view: %+v", p)
+	}
+	// 空なら全てのレイヤー、指定した場合はそのレイヤーだけを書き出す
+	if !viewport.Contains(3) {
+		t.Errorf("empty layers should contain every layer")
+	}
+	viewport.Layers = []data.LayerIdentifier{1, 2}
+	if !viewport.Contains(2) || viewport.Contains(3) {
+		t.Errorf("layers: %v", viewport.Layers)
+	}
+}